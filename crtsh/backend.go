@@ -0,0 +1,674 @@
+package crtsh
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/quals"
+)
+
+const (
+	backendPostgres = "postgres"
+	backendMemory   = "memory"
+	backendHTTP     = "http"
+	// backendAuto uses the postgres backend, falling back to the HTTP API if
+	// the database cannot be reached.
+	backendAuto = "auto"
+)
+
+// backend is a source of crt.sh data. Each list function asks the backend for
+// typed rows and streams them, so the tables work the same way whether the
+// data comes from the crt.sh Postgres database, a self-hosted certwatch
+// replica or an in-memory fixture.
+//
+// The row callback returns false when no more rows are wanted (e.g. the
+// query limit has been reached), in which case the backend should stop and
+// return nil.
+type backend interface {
+	ListCa(ctx context.Context, req *listRequest, fn func(caRow) bool) error
+	ListCaIssuer(ctx context.Context, req *listRequest, fn func(caIssuerRow) bool) error
+	ListCertificate(ctx context.Context, req *listRequest, fn func(certificateRow) bool) error
+	ListLog(ctx context.Context, req *listRequest, fn func(logRow) bool) error
+	ListLogEntry(ctx context.Context, req *listRequest, fn func(logEntryRow) bool) error
+	Close() error
+}
+
+// certificateFetcher is implemented by backends whose certificate rows do not
+// include the certificate, which is then downloaded for the columns that
+// need it.
+type certificateFetcher interface {
+	getCertificateDER(ctx context.Context, id int64) ([]byte, error)
+}
+
+// listRequest is the backend independent description of a list call: the
+// table being queried, the quals pushed down for its key columns, the sort
+// order and the query limit.
+//
+// Steampipe does not sort rows again when the sort order is pushed down, so
+// every backend must return rows in SortOrder.
+type listRequest struct {
+	Table     string
+	Columns   []*plugin.Column
+	Quals     plugin.KeyColumnQualMap
+	SortOrder []*plugin.SortColumn
+	Limit     *int64
+}
+
+func newListRequest(d *plugin.QueryData) *listRequest {
+	return &listRequest{
+		Table:     d.Table.Name,
+		Columns:   d.Table.Columns,
+		Quals:     d.Quals,
+		SortOrder: d.QueryContext.SortOrder,
+		Limit:     d.QueryContext.Limit,
+	}
+}
+
+// describeQuals returns a readable summary of the quals pushed down for the
+// request, e.g. "query = 'example.com', not_after > 2024-01-01T00:00:00Z",
+// for use in error messages and to name fixture recordings.
+func (req *listRequest) describeQuals() string {
+	var parts []string
+	for _, col := range req.Columns {
+		if req.Quals[col.Name] == nil {
+			continue
+		}
+		for _, q := range req.Quals[col.Name].Quals {
+			parts = append(parts, strings.TrimSpace(fmt.Sprintf("%s %s %s", col.Name, q.Operator, qualValueString(q.Value))))
+		}
+	}
+	if len(req.SortOrder) > 0 {
+		var order []string
+		for _, o := range req.SortOrder {
+			order = append(order, fmt.Sprintf("%s %s", o.Column, o.Order))
+		}
+		parts = append(parts, "order by "+strings.Join(order, ", "))
+	}
+	if req.Limit != nil {
+		parts = append(parts, fmt.Sprintf("limit %d", *req.Limit))
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func qualValueString(v *proto.QualValue) string {
+	if v == nil {
+		return ""
+	}
+	switch v.Value.(type) {
+	case *proto.QualValue_StringValue:
+		return "'" + v.GetStringValue() + "'"
+	case *proto.QualValue_Int64Value:
+		return strconv.FormatInt(v.GetInt64Value(), 10)
+	case *proto.QualValue_DoubleValue:
+		return strconv.FormatFloat(v.GetDoubleValue(), 'f', -1, 64)
+	case *proto.QualValue_BoolValue:
+		return strconv.FormatBool(v.GetBoolValue())
+	case *proto.QualValue_TimestampValue:
+		return v.GetTimestampValue().AsTime().Format(time.RFC3339)
+	case *proto.QualValue_ListValue:
+		var values []string
+		for _, lv := range v.GetListValue().Values {
+			values = append(values, qualValueString(lv))
+		}
+		return "(" + strings.Join(values, ", ") + ")"
+	default:
+		return v.String()
+	}
+}
+
+// healthCheckInterval is how often the backend of a connection is checked,
+// in the background. Failures between checks are left to the retry of
+// transient errors.
+const healthCheckInterval = time.Minute
+
+// maxProbeInterval is the longest time the auto backend waits before trying
+// the database again after falling back to the HTTP API. The wait doubles
+// from healthCheckInterval after each failed attempt.
+const maxProbeInterval = time.Hour
+
+// autoConnectTimeout is the connect_timeout, in seconds, of the auto backend
+// when none is set. Where the port is blocked without being refused, the
+// connection would otherwise hang until the operating system gives up.
+const autoConnectTimeout = 5
+
+// checkTimeout limits how long a check of a cached backend may take.
+const checkTimeout = 30 * time.Second
+
+// cachedBackend is the open backend for a connection. Its fields are guarded
+// by mu, so queries on one connection never wait for another.
+type cachedBackend struct {
+	mu sync.Mutex
+	// key identifies the config the backend was created from
+	key     string
+	backend backend
+	checked time.Time
+	// fallback is true if the auto backend could not reach the database and
+	// is using the HTTP API instead
+	fallback bool
+	// probes is the number of failed attempts to reach the database since
+	// falling back
+	probes int
+	// checking is true while the backend is being checked, so only one query
+	// checks it at a time
+	checking bool
+	// opening is closed when the backend being opened for the connection is
+	// ready, or nil if the backend is not being opened
+	opening chan struct{}
+}
+
+// checkInterval returns the time between checks of the backend.
+func (c *cachedBackend) checkInterval() time.Duration {
+	if !c.fallback {
+		return healthCheckInterval
+	}
+	interval := healthCheckInterval
+	for i := 0; i < c.probes && interval < maxProbeInterval; i++ {
+		interval *= 2
+	}
+	return min(interval, maxProbeInterval)
+}
+
+// backends holds the open backend for each connection, keyed by connection
+// name. Each connection has its own pool, so connections pointing at
+// different databases never share one. backendsMu only guards the map.
+var (
+	backends   = map[string]*cachedBackend{}
+	backendsMu sync.Mutex
+)
+
+func connectionBackend(connectionName string) *cachedBackend {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	c, ok := backends[connectionName]
+	if !ok {
+		c = &cachedBackend{}
+		backends[connectionName] = c
+	}
+	return c
+}
+
+// getBackend returns the backend configured for the connection, creating it
+// on first use or when the connection config has changed.
+//
+// Connecting can be slow, so it is never done while holding a lock. Queries
+// that need a backend while it is being opened wait for it, and checks of an
+// open backend run in the background while queries keep using it.
+func getBackend(ctx context.Context, d *plugin.QueryData) (backend, error) {
+	config := GetConfig(d.Connection)
+	key := config.key()
+	c := connectionBackend(d.Connection.Name)
+
+	c.mu.Lock()
+	for c.opening != nil {
+		opening := c.opening
+		c.mu.Unlock()
+		select {
+		case <-opening:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		c.mu.Lock()
+	}
+
+	if c.backend != nil && c.key == key {
+		if !c.checking && time.Since(c.checked) >= c.checkInterval() {
+			c.checking = true
+			go c.check(context.WithoutCancel(ctx), d.Connection.Name, config)
+		}
+		b := c.backend
+		c.mu.Unlock()
+		return b, nil
+	}
+
+	// The config has changed, or there is no backend yet
+	old := c.backend
+	opening := make(chan struct{})
+	c.backend, c.opening = nil, opening
+	c.mu.Unlock()
+	closeConnectionBackend(ctx, d.Connection.Name, old)
+
+	b, fallback, err := newBackend(ctx, config)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	close(opening)
+	c.opening = nil
+	if err != nil {
+		return nil, err
+	}
+	c.key, c.backend, c.checked, c.fallback, c.probes = key, b, time.Now(), fallback, 0
+	return b, nil
+}
+
+// check checks the backend of a connection. If the auto backend has fallen
+// back to the HTTP API it tries the database again, switching back to it if
+// it can now be reached.
+//
+// A database that fails a health check is only logged. database/sql discards
+// broken connections and opens new ones as needed, while closing the pool
+// would fail every scan in progress on it.
+func (c *cachedBackend) check(ctx context.Context, connectionName string, config crtshConfig) {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	c.mu.Lock()
+	current, fallback := c.backend, c.fallback
+	c.mu.Unlock()
+
+	if !fallback {
+		healthy(ctx, current)
+		c.mu.Lock()
+		c.checking, c.checked = false, time.Now()
+		c.mu.Unlock()
+		return
+	}
+
+	b, stillFallback, err := newBackend(ctx, config)
+	c.mu.Lock()
+	c.checking, c.checked = false, time.Now()
+	if err != nil || stillFallback || c.backend != current {
+		// Still unreachable, or the config changed while connecting
+		if c.backend == current {
+			c.probes++
+		}
+		c.mu.Unlock()
+		if err == nil {
+			closeConnectionBackend(ctx, connectionName, b)
+		}
+		return
+	}
+	c.backend, c.fallback, c.probes = b, false, 0
+	c.mu.Unlock()
+
+	plugin.Logger(ctx).Info("crtsh.check", "connection", connectionName, "postgres_available", true)
+	closeConnectionBackend(ctx, connectionName, current)
+}
+
+func newBackend(ctx context.Context, config crtshConfig) (b backend, fallback bool, err error) {
+	if config.FixtureMode != nil && *config.FixtureMode == fixtureModeReplay {
+		return &replayBackend{dir: *config.FixtureDir}, false, nil
+	}
+
+	name := backendPostgres
+	if config.Backend != nil {
+		name = *config.Backend
+	}
+
+	switch name {
+	case backendPostgres:
+		b, err = newPostgresBackend(ctx, config)
+	case backendHTTP:
+		b = newHTTPBackend(config)
+	case backendAuto:
+		if config.ConnectTimeout == nil {
+			timeout := autoConnectTimeout
+			config.ConnectTimeout = &timeout
+		}
+		b, err = newPostgresBackend(ctx, config)
+		if err != nil {
+			plugin.Logger(ctx).Warn("crtsh.newBackend", "postgres_unavailable", err, "fallback", backendHTTP)
+			b, fallback, err = newHTTPBackend(config), true, nil
+		}
+	case backendMemory:
+		b, err = loadMemoryBackend(*config.FixtureFile)
+	default:
+		err = fmt.Errorf("unsupported backend %q", name)
+	}
+
+	if err == nil && config.FixtureMode != nil && *config.FixtureMode == fixtureModeRecord {
+		b = &recordingBackend{backend: b, dir: *config.FixtureDir}
+	}
+	return b, fallback, err
+}
+
+// healthy checks that a backend which holds connections can still reach the
+// server.
+func healthy(ctx context.Context, b backend) bool {
+	p, ok := b.(interface{ Ping(context.Context) error })
+	if !ok {
+		return true
+	}
+	if err := p.Ping(ctx); err != nil {
+		plugin.Logger(ctx).Warn("crtsh.healthy", "ping_error", err)
+		return false
+	}
+	return true
+}
+
+// closeBackend closes the open backend for the connection, if any.
+func closeBackend(ctx context.Context, connectionName string) {
+	c := connectionBackend(connectionName)
+	c.mu.Lock()
+	b := c.backend
+	c.backend = nil
+	c.mu.Unlock()
+	closeConnectionBackend(ctx, connectionName, b)
+}
+
+func closeConnectionBackend(ctx context.Context, connectionName string, b backend) {
+	if b == nil {
+		return
+	}
+	if err := b.Close(); err != nil {
+		plugin.Logger(ctx).Warn("crtsh.closeBackend", "connection", connectionName, "close_error", err)
+	}
+}
+
+// connectionConfigChanged closes the backend of a connection whose config
+// has changed, so the next query opens a new one with the new settings.
+func connectionConfigChanged(ctx context.Context, p *plugin.Plugin, old, new *plugin.Connection) error {
+	closeBackend(ctx, new.Name)
+	if err := p.ClearConnectionCache(ctx, new.Name); err != nil {
+		return err
+	}
+	return p.ClearQueryCache(ctx, new.Name)
+}
+
+// streamRows passes each row to fn until it asks to stop.
+func streamRows[T any](rows []T, fn func(T) bool) error {
+	for _, row := range rows {
+		if !fn(row) {
+			break
+		}
+	}
+	return nil
+}
+
+// sortRows returns a copy of rows sorted by the sort order of the request, for
+// backends that cannot sort on the server. Columns are matched to the row
+// fields by their db tag, falling back to the column mapping of the table. As
+// in Postgres, nulls sort last in ascending order and first in descending
+// order.
+func sortRows[T any](rows []T, req *listRequest, columns []sqlColumn) []T {
+	if len(req.SortOrder) == 0 {
+		return rows
+	}
+	rows = slices.Clone(rows)
+	fields := dbFields(reflect.TypeOf(rows).Elem())
+	exprs := map[string]string{}
+	for _, col := range columns {
+		exprs[col.Name] = col.expr()
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, o := range req.SortOrder {
+			field, ok := fields[o.Column]
+			if !ok {
+				if field, ok = fields[exprs[o.Column]]; !ok {
+					continue
+				}
+			}
+			c := compareValues(reflect.ValueOf(rows[i]).Field(field), reflect.ValueOf(rows[j]).Field(field))
+			if c == 0 {
+				continue
+			}
+			if o.Order == plugin.SortDesc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+	return rows
+}
+
+// dbFields maps the db tags of a row type to its field indexes.
+func dbFields(t reflect.Type) map[string]int {
+	fields := map[string]int{}
+	for i := 0; i < t.NumField(); i++ {
+		fields[t.Field(i).Tag.Get("db")] = i
+	}
+	return fields
+}
+
+// compareValues compares two row fields, treating a nil pointer as greater
+// than any value.
+func compareValues(a, b reflect.Value) int {
+	if a.Kind() == reflect.Ptr {
+		switch {
+		case a.IsNil() && b.IsNil():
+			return 0
+		case a.IsNil():
+			return 1
+		case b.IsNil():
+			return -1
+		}
+		a, b = a.Elem(), b.Elem()
+	}
+	if at, ok := a.Interface().(time.Time); ok {
+		return at.Compare(b.Interface().(time.Time))
+	}
+	switch a.Kind() {
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return cmp.Compare(a.Int(), b.Int())
+	case reflect.String:
+		return cmp.Compare(a.String(), b.String())
+	case reflect.Bool:
+		return cmp.Compare(boolToInt(a.Bool()), boolToInt(b.Bool()))
+	default:
+		return 0
+	}
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// filterRows returns the rows matching the quals of the request for the
+// given columns, for backends that cannot filter on the server. Steampipe
+// pushes the limit down when every qual is for a key column, so the rows must
+// be filtered before the limit is applied rather than left to Steampipe.
+//
+// value returns the value of a column for a row, or false if it is unknown,
+// in which case the quals of that column are not applied.
+func filterRows[T any](rows []T, req *listRequest, columns []sqlColumn, value func(T, sqlColumn) (interface{}, bool)) []T {
+	var filtered []T
+	for _, row := range rows {
+		if matchesQuals(req, columns, func(col sqlColumn) (interface{}, bool) { return value(row, col) }) {
+			filtered = append(filtered, row)
+		}
+	}
+	return filtered
+}
+
+// rowValue returns the value of a column of a row struct, matching the
+// column to the fields by their db tag as in sortRows. Values are returned as
+// the types used for query arguments, e.g. int64, with nil for null.
+func rowValue[T any](row T, col sqlColumn) (interface{}, bool) {
+	v := reflect.ValueOf(row)
+	fields := dbFields(v.Type())
+	field, ok := fields[col.Name]
+	if !ok {
+		if field, ok = fields[col.expr()]; !ok {
+			return nil, false
+		}
+	}
+	f := v.Field(field)
+	if f.Kind() == reflect.Ptr {
+		if f.IsNil() {
+			return nil, true
+		}
+		f = f.Elem()
+	}
+	if t, ok := f.Interface().(time.Time); ok {
+		return t, true
+	}
+	switch f.Kind() {
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return f.Int(), true
+	case reflect.String:
+		return f.String(), true
+	case reflect.Bool:
+		return f.Bool(), true
+	default:
+		return nil, false
+	}
+}
+
+// matchesQuals reports whether a row, given by its column values, satisfies
+// every qual of the request for the columns. Quals are evaluated as Postgres
+// would, so a comparison with null is never true.
+func matchesQuals(req *listRequest, columns []sqlColumn, value func(sqlColumn) (interface{}, bool)) bool {
+	for _, col := range columns {
+		if req.Quals[col.Name] == nil {
+			continue
+		}
+		v, ok := value(col)
+		if !ok {
+			continue
+		}
+		for _, q := range req.Quals[col.Name].Quals {
+			if !matchesQual(col, q, v) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func matchesQual(col sqlColumn, q *quals.Qual, v interface{}) bool {
+	switch q.Operator {
+	case "is null":
+		return v == nil
+	case "is not null":
+		return v != nil
+	}
+	if v == nil {
+		return false
+	}
+
+	if list := q.Value.GetListValue(); list != nil {
+		for _, lv := range list.Values {
+			arg, ok := qualArg(col, lv)
+			if !ok {
+				return true
+			}
+			c, ok := compareArgs(v, arg)
+			switch {
+			case !ok:
+				return true
+			case q.Operator == "=" && c == 0:
+				return true
+			case q.Operator == "<>" && c == 0:
+				return false
+			}
+		}
+		return q.Operator == "<>"
+	}
+
+	arg, ok := qualArg(col, q.Value)
+	if !ok {
+		return true
+	}
+	switch q.Operator {
+	case "~~", "~~*", "!~~", "!~~*", "~", "~*", "!~", "!~*":
+		s, ok1 := v.(string)
+		pattern, ok2 := arg.(string)
+		if !ok1 || !ok2 {
+			return true
+		}
+		return matchesPattern(q.Operator, pattern, s)
+	}
+	c, ok := compareArgs(v, arg)
+	if !ok {
+		return true
+	}
+	switch q.Operator {
+	case "=":
+		return c == 0
+	case "<>":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	default:
+		return true
+	}
+}
+
+// compareArgs compares a row value with a qual argument of the same type.
+func compareArgs(a, b interface{}) (int, bool) {
+	switch a := a.(type) {
+	case int64:
+		b, ok := b.(int64)
+		return cmp.Compare(a, b), ok
+	case string:
+		b, ok := b.(string)
+		return cmp.Compare(a, b), ok
+	case bool:
+		b, ok := b.(bool)
+		return cmp.Compare(boolToInt(a), boolToInt(b)), ok
+	case time.Time:
+		b, ok := b.(time.Time)
+		return a.Compare(b), ok
+	case []byte:
+		b, ok := b.([]byte)
+		return bytes.Compare(a, b), ok
+	default:
+		return 0, false
+	}
+}
+
+// matchesPattern evaluates a like or regex operator. Like patterns are
+// converted to regular expressions, with \ escaping a wildcard.
+func matchesPattern(operator, pattern, s string) bool {
+	negate := strings.HasPrefix(operator, "!")
+	operator = strings.TrimPrefix(operator, "!")
+
+	expr := pattern
+	if strings.HasPrefix(operator, "~~") {
+		var sb strings.Builder
+		sb.WriteString("^")
+		escaped := false
+		for _, r := range pattern {
+			switch {
+			case escaped:
+				sb.WriteString(regexp.QuoteMeta(string(r)))
+				escaped = false
+			case r == '\\':
+				escaped = true
+			case r == '%':
+				sb.WriteString("(?s:.*)")
+			case r == '_':
+				sb.WriteString("(?s:.)")
+			default:
+				sb.WriteString(regexp.QuoteMeta(string(r)))
+			}
+		}
+		sb.WriteString("$")
+		expr = sb.String()
+	}
+	if strings.HasSuffix(operator, "*") {
+		expr = "(?i)" + expr
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		// Postgres fails the query for an invalid regex, so nothing matches.
+		return false
+	}
+	return re.MatchString(s) != negate
+}
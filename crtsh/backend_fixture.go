@@ -0,0 +1,173 @@
+package crtsh
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+)
+
+const (
+	fixtureModeRecord = "record"
+	fixtureModeReplay = "replay"
+)
+
+// recording is the file saved for each list call, holding the rows returned
+// for a table and set of pushed down quals.
+type recording[T any] struct {
+	Table string `json:"table"`
+	Quals string `json:"quals"`
+	Rows  []T    `json:"rows"`
+}
+
+// recordingPath returns the file for a list call, e.g.
+// <dir>/crtsh_certificate/<hash of quals>.json
+func recordingPath(dir string, req *listRequest) string {
+	sum := sha256.Sum256([]byte(req.describeQuals()))
+	return filepath.Join(dir, req.Table, hex.EncodeToString(sum[:8])+".json")
+}
+
+// recordingBackend passes list calls through to another backend, saving the
+// rows it returns to fixture_dir so they can be replayed offline later.
+type recordingBackend struct {
+	backend
+	dir string
+}
+
+// Ping checks the backend being recorded, as the embedded interface does not
+// include it.
+func (b *recordingBackend) Ping(ctx context.Context) error {
+	if p, ok := b.backend.(interface{ Ping(context.Context) error }); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (b *recordingBackend) ListCa(ctx context.Context, req *listRequest, fn func(caRow) bool) error {
+	return recordRows(ctx, b.dir, req, func(f func(caRow) bool) error { return b.backend.ListCa(ctx, req, f) }, fn)
+}
+
+func (b *recordingBackend) ListCaIssuer(ctx context.Context, req *listRequest, fn func(caIssuerRow) bool) error {
+	return recordRows(ctx, b.dir, req, func(f func(caIssuerRow) bool) error { return b.backend.ListCaIssuer(ctx, req, f) }, fn)
+}
+
+func (b *recordingBackend) ListCertificate(ctx context.Context, req *listRequest, fn func(certificateRow) bool) error {
+	fetcher, _ := b.backend.(certificateFetcher)
+	var fetchErr error
+	list := func(f func(certificateRow) bool) error {
+		err := b.backend.ListCertificate(ctx, req, func(row certificateRow) bool {
+			// Save the certificate with the row, so replaying does not need to
+			// download it.
+			if len(row.Certificate) == 0 && fetcher != nil {
+				row.Certificate, fetchErr = fetcher.getCertificateDER(ctx, int64(row.CertificateID))
+				if fetchErr != nil {
+					return false
+				}
+			}
+			return f(row)
+		})
+		if err == nil {
+			err = fetchErr
+		}
+		return err
+	}
+	return recordRows(ctx, b.dir, req, list, fn)
+}
+
+func (b *recordingBackend) ListLog(ctx context.Context, req *listRequest, fn func(logRow) bool) error {
+	return recordRows(ctx, b.dir, req, func(f func(logRow) bool) error { return b.backend.ListLog(ctx, req, f) }, fn)
+}
+
+func (b *recordingBackend) ListLogEntry(ctx context.Context, req *listRequest, fn func(logEntryRow) bool) error {
+	return recordRows(ctx, b.dir, req, func(f func(logEntryRow) bool) error { return b.backend.ListLogEntry(ctx, req, f) }, fn)
+}
+
+// recordRows streams the rows from list to fn, then saves them. Nothing is
+// saved if the list call fails, so a recording is always a complete result.
+func recordRows[T any](ctx context.Context, dir string, req *listRequest, list func(func(T) bool) error, fn func(T) bool) error {
+	rows := []T{}
+	err := list(func(row T) bool {
+		rows = append(rows, row)
+		return fn(row)
+	})
+	if err != nil {
+		return err
+	}
+
+	path := recordingPath(dir, req)
+	data, err := json.MarshalIndent(recording[T]{Table: req.Table, Quals: req.describeQuals(), Rows: rows}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create fixture directory: %w", err)
+	}
+	// Write to a temporary file first so a concurrent replay never reads a
+	// partial recording.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write recording: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write recording: %w", err)
+	}
+
+	plugin.Logger(ctx).Debug(req.Table+".recordRows", "path", path, "rows", len(rows))
+	return nil
+}
+
+// replayBackend serves list calls from the recordings in fixture_dir, without
+// any network access.
+type replayBackend struct {
+	dir string
+}
+
+func (b *replayBackend) ListCa(ctx context.Context, req *listRequest, fn func(caRow) bool) error {
+	return replayRows(ctx, b.dir, req, fn)
+}
+
+func (b *replayBackend) ListCaIssuer(ctx context.Context, req *listRequest, fn func(caIssuerRow) bool) error {
+	return replayRows(ctx, b.dir, req, fn)
+}
+
+func (b *replayBackend) ListCertificate(ctx context.Context, req *listRequest, fn func(certificateRow) bool) error {
+	return replayRows(ctx, b.dir, req, fn)
+}
+
+func (b *replayBackend) ListLog(ctx context.Context, req *listRequest, fn func(logRow) bool) error {
+	return replayRows(ctx, b.dir, req, fn)
+}
+
+func (b *replayBackend) ListLogEntry(ctx context.Context, req *listRequest, fn func(logEntryRow) bool) error {
+	return replayRows(ctx, b.dir, req, fn)
+}
+
+func (b *replayBackend) Close() error {
+	return nil
+}
+
+// replayRows streams the rows recorded for the list call to fn.
+func replayRows[T any](ctx context.Context, dir string, req *listRequest, fn func(T) bool) error {
+	path := recordingPath(dir, req)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%s: no recording found for quals %s, run the query with fixture_mode = \"%s\" first", req.Table, req.describeQuals(), fixtureModeRecord)
+	}
+	if err != nil {
+		return err
+	}
+
+	var r recording[T]
+	if err := json.Unmarshal(data, &r); err != nil {
+		return fmt.Errorf("failed to parse recording %s: %w", path, err)
+	}
+
+	plugin.Logger(ctx).Debug(req.Table+".replayRows", "path", path, "rows", len(r.Rows))
+	return streamRows(r.Rows, fn)
+}
@@ -0,0 +1,103 @@
+package crtsh
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// The recordings in testdata/recordings were made from testdata/memory.json
+// with fixture_mode = "record".
+const testRecordingsDir = "testdata/recordings"
+
+func TestReplayListCertificate(t *testing.T) {
+	b := &replayBackend{dir: testRecordingsDir}
+
+	rows := listAll(t, testRequest(tableCrtshCertificate(), testQual("query", "=", "example.com"), testQual("match", "=", "suffix")), b.ListCertificate)
+	var ids []int
+	for _, row := range rows {
+		ids = append(ids, row.CertificateID)
+	}
+	if want := []int{102, 101}; !slices.Equal(ids, want) {
+		t.Errorf("got ids %v, want %v", ids, want)
+	}
+
+	rows = listAll(t, testRequest(tableCrtshCertificate(), testQual("id", "=", 104)), b.ListCertificate)
+	if len(rows) != 1 {
+		t.Fatalf("got %d rows for id 104, want one", len(rows))
+	}
+	// The certificate is recorded with the row, so the x509 columns can be
+	// hydrated offline.
+	cert, err := x509.ParseCertificate(rows[0].Certificate)
+	if err != nil {
+		t.Fatalf("recorded certificate cannot be parsed: %v", err)
+	}
+	if got := cert.Subject.CommonName; got != "secure.example.com" {
+		t.Errorf("got common name %q, want secure.example.com", got)
+	}
+}
+
+func TestReplayListLogEntry(t *testing.T) {
+	b := &replayBackend{dir: testRecordingsDir}
+
+	rows := listAll(t, testRequest(tableCrtshLogEntry(), testQual("certificate_id", "=", 102)), b.ListLogEntry)
+	var entries [][2]int
+	for _, row := range rows {
+		entries = append(entries, [2]int{row.CtLogID, row.EntryID})
+	}
+	if want := [][2]int{{1, 11}, {2, 7}}; !slices.Equal(entries, want) {
+		t.Errorf("got log entries %v, want %v", entries, want)
+	}
+}
+
+func TestReplayMissingRecording(t *testing.T) {
+	b := &replayBackend{dir: testRecordingsDir}
+	err := b.ListLogEntry(testContext(), testRequest(tableCrtshLogEntry(), testQual("certificate_id", "=", 999)), func(logEntryRow) bool { return true })
+	if err == nil || !strings.Contains(err.Error(), "no recording found for quals certificate_id = 999") {
+		t.Errorf("got error %v, want no recording found", err)
+	}
+}
+
+func TestRecordThenReplay(t *testing.T) {
+	dir := t.TempDir()
+	source := loadTestMemoryBackend(t)
+	recorder := &recordingBackend{backend: source, dir: dir}
+	replayer := &replayBackend{dir: dir}
+
+	req := testRequest(tableCrtshLogEntry(), testQual("ct_log_id", "=", 1))
+	req.Limit = testLimit(2)
+	recorded := listAll(t, req, recorder.ListLogEntry)
+	replayed := listAll(t, req, replayer.ListLogEntry)
+	if len(recorded) != 2 || !reflect.DeepEqual(recorded, replayed) {
+		t.Errorf("replayed %v, want the recorded %v", replayed, recorded)
+	}
+
+	req = testRequest(tableCrtshCa(), testQual("name", "~~*", "%test%"))
+	recordedCas := listAll(t, req, recorder.ListCa)
+	replayedCas := listAll(t, req, replayer.ListCa)
+	if len(recordedCas) != 3 || !reflect.DeepEqual(recordedCas, replayedCas) {
+		t.Errorf("replayed %v, want the recorded %v", replayedCas, recordedCas)
+	}
+}
+
+// pingBackend is a backend whose health check fails.
+type pingBackend struct {
+	memoryBackend
+}
+
+func (b *pingBackend) Ping(context.Context) error {
+	return errors.New("unreachable")
+}
+
+func TestRecordingBackendPing(t *testing.T) {
+	if healthy(testContext(), &recordingBackend{backend: &pingBackend{}}) {
+		t.Error("recording backend is healthy, want the ping of the recorded backend to fail")
+	}
+	if !healthy(testContext(), &recordingBackend{backend: &memoryBackend{}}) {
+		t.Error("recording backend of a backend without connections is unhealthy")
+	}
+}
@@ -0,0 +1,388 @@
+package crtsh
+
+import (
+	"cmp"
+	"context"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+)
+
+const defaultHTTPURL = "https://crt.sh"
+
+// httpTimeout bounds each request to the crt.sh web interface, including
+// reading the response.
+const httpTimeout = time.Minute
+
+// httpTimeFormat is the format of the timestamps in the crt.sh JSON search
+// results, which are in UTC.
+const httpTimeFormat = "2006-01-02T15:04:05"
+
+// httpBackend serves crtsh_certificate from the crt.sh web interface, for
+// networks where the Postgres port is blocked. Search results come from
+// ?q=...&output=json and certificates are downloaded from ?d=<id> when the
+// parsed x509 columns are requested.
+//
+// The other tables are only available in the database, so they return an
+// error when using this backend.
+type httpBackend struct {
+	client  *http.Client
+	baseURL string
+	retry   retryConfig
+}
+
+func newHTTPBackend(config crtshConfig) *httpBackend {
+	baseURL := defaultHTTPURL
+	if config.HTTPURL != nil {
+		baseURL = *config.HTTPURL
+	}
+	return &httpBackend{
+		client:  &http.Client{Timeout: httpTimeout},
+		baseURL: strings.TrimRight(baseURL, "/"),
+		retry:   newRetryConfig(config),
+	}
+}
+
+// httpCertificate is a single entry in the crt.sh JSON search results. There
+// is one entry per log entry, so a certificate may appear more than once.
+type httpCertificate struct {
+	ID         int64  `json:"id"`
+	IssuerCaID int    `json:"issuer_ca_id"`
+	NameValue  string `json:"name_value"`
+	NotBefore  string `json:"not_before"`
+	NotAfter   string `json:"not_after"`
+}
+
+func (b *httpBackend) ListCa(_ context.Context, req *listRequest, _ func(caRow) bool) error {
+	return b.unsupported(req)
+}
+
+func (b *httpBackend) ListCaIssuer(_ context.Context, req *listRequest, _ func(caIssuerRow) bool) error {
+	return b.unsupported(req)
+}
+
+func (b *httpBackend) ListLog(_ context.Context, req *listRequest, _ func(logRow) bool) error {
+	return b.unsupported(req)
+}
+
+func (b *httpBackend) ListLogEntry(_ context.Context, req *listRequest, _ func(logEntryRow) bool) error {
+	return b.unsupported(req)
+}
+
+func (b *httpBackend) Close() error {
+	b.client.CloseIdleConnections()
+	return nil
+}
+
+func (b *httpBackend) unsupported(req *listRequest) error {
+	return fmt.Errorf("%s is not available from the crt.sh HTTP API, use the postgres backend", req.Table)
+}
+
+func (b *httpBackend) ListCertificate(ctx context.Context, req *listRequest, fn func(certificateRow) bool) error {
+
+	// The search results list every identity of a certificate without their
+	// types, so rows would never match a name_type qual.
+	if req.Quals["name_type"] != nil && len(req.Quals["name_type"].Quals) > 0 {
+		return fmt.Errorf("%s: name_type is not available from the crt.sh HTTP API, use the postgres backend", req.Table)
+	}
+
+	var id *int64
+	if qual := equalsQual(req, "id"); qual != nil {
+		v := qual.Value.GetInt64Value()
+		id = &v
+	}
+
+	match, err := certificateMatch(req)
+	if err != nil {
+		return err
+	}
+
+	// The crt.sh search also accepts a SHA-1 or SHA-256 fingerprint, and has
+	// separate parameters for subject organizations and emails, serial
+	// numbers and public keys.
+	params := url.Values{}
+	var query, domain, searched string
+	// The domain is matched against the results even when it is not the
+	// search, as Steampipe cannot check it.
+	if qual := equalsQual(req, "domain"); qual != nil {
+		domain = qual.Value.GetStringValue()
+	}
+	if qual := equalsQual(req, "query"); qual != nil {
+		query, searched = qual.Value.GetStringValue(), "query"
+		params.Set("q", query)
+	} else if domain != "" {
+		searched = "domain"
+		params.Set("q", domain)
+	} else if qual := equalsQual(req, "organization"); qual != nil {
+		searched = "organization"
+		params.Set("O", qual.Value.GetStringValue())
+	} else if qual := equalsQual(req, "email"); qual != nil {
+		searched = "email"
+		params.Set("E", qual.Value.GetStringValue())
+	} else if qual := equalsQual(req, "fingerprint_sha256"); qual != nil {
+		searched = "fingerprint_sha256"
+		params.Set("q", hex.EncodeToString(decodeHex(qual.Value.GetStringValue())))
+	} else if qual := equalsQual(req, "fingerprint_sha1"); qual != nil {
+		searched = "fingerprint_sha1"
+		params.Set("q", hex.EncodeToString(decodeHex(qual.Value.GetStringValue())))
+	} else if qual := equalsQual(req, "serial_number"); qual != nil {
+		searched = "serial_number"
+		params.Set("serial", strings.ReplaceAll(qual.Value.GetStringValue(), ":", ""))
+	} else if qual := equalsQual(req, "spki_sha256"); qual != nil {
+		searched = "spki_sha256"
+		params.Set("spkisha256", hex.EncodeToString(decodeHex(qual.Value.GetStringValue())))
+	}
+	// The search results do not say which identities are organizations or
+	// emails, so those quals can only be applied as the search itself.
+	for _, col := range []string{"organization", "email"} {
+		if col != searched && req.Quals[col] != nil && len(req.Quals[col].Quals) > 0 {
+			return fmt.Errorf("%s: %s cannot be combined with %s when using the crt.sh HTTP API, use the postgres backend", req.Table, col, searched)
+		}
+	}
+	// A hash that is not hex cannot match any certificate
+	for _, param := range []string{"q", "spkisha256"} {
+		if params.Has(param) && params.Get(param) == "" {
+			return nil
+		}
+	}
+	if len(params) == 0 {
+		if id == nil {
+			return fmt.Errorf("%s requires an id, query, domain, organization, email, fingerprint, serial_number or spki_sha256 qual when using the crt.sh HTTP API", req.Table)
+		}
+		row, err := b.getCertificate(ctx, *id)
+		if err != nil || row == nil || excludedExpired(req, *row) {
+			return err
+		}
+		return streamRows(filterRows([]certificateRow{*row}, req, certificateColumns, certificateValue), fn)
+	}
+
+	params.Set("output", "json")
+	if qual := equalsQual(req, "exclude_expired"); qual != nil && qual.Value.GetBoolValue() {
+		params.Set("exclude", "expired")
+	}
+
+	body, err := b.get(ctx, params)
+	if err != nil || body == nil {
+		return err
+	}
+	defer body.Close()
+
+	var results []httpCertificate
+	if err := json.NewDecoder(body).Decode(&results); err != nil {
+		return fmt.Errorf("failed to parse crt.sh search results: %w", err)
+	}
+
+	seen := map[int64]bool{}
+	rows := []certificateRow{}
+	for _, r := range results {
+		if seen[r.ID] || (id != nil && r.ID != *id) || !matchesAnyName(match, query, r.NameValue) || (domain != "" && !matchesAnyDomain(domain, r.NameValue)) {
+			continue
+		}
+		seen[r.ID] = true
+
+		issuerCaID := r.IssuerCaID
+		row := certificateRow{
+			CertificateID: int(r.ID),
+			IssuerCaID:    &issuerCaID,
+			NameValue:     r.NameValue,
+		}
+		if notBefore, err := time.Parse(httpTimeFormat, r.NotBefore); err == nil {
+			row.NotBefore = &notBefore
+		} else {
+			plugin.Logger(ctx).Warn("crtsh_certificate.httpBackend", "not_before_error", err, "id", r.ID)
+		}
+		if notAfter, err := time.Parse(httpTimeFormat, r.NotAfter); err == nil {
+			row.NotAfter = &notAfter
+		} else {
+			plugin.Logger(ctx).Warn("crtsh_certificate.httpBackend", "not_after_error", err, "id", r.ID)
+		}
+		rows = append(rows, row)
+	}
+
+	// The search only narrows the results by the search quals, so the other
+	// quals, e.g. not_after and issuer_ca_id, are applied here before the
+	// limit pushed down by Steampipe.
+	rows = filterRows(rows, req, certificateColumns, certificateValue)
+
+	// Quals on the columns computed from the certificate could not be applied
+	// above, as the search results do not include it. Download the
+	// certificates of the remaining rows to apply them, rather than let rows
+	// that do not match use up the limit.
+	if needsCertificate(req, searched) {
+		for i := range rows {
+			der, err := b.getCertificateDER(ctx, int64(rows[i].CertificateID))
+			if err != nil {
+				return err
+			}
+			rows[i].Certificate = der
+		}
+		rows = filterRows(rows, req, certificateColumns, certificateValue)
+	}
+
+	// Newest first, as for the postgres backend
+	slices.SortStableFunc(rows, func(a, b certificateRow) int { return cmp.Compare(b.CertificateID, a.CertificateID) })
+	return streamRows(sortRows(rows, req, certificateColumns), fn)
+}
+
+// certificateDERColumns are the key columns of crtsh_certificate computed
+// from the certificate.
+var certificateDERColumns = []string{"fingerprint_sha1", "fingerprint_sha256", "serial_number", "spki_sha256"}
+
+// needsCertificate reports whether the request has quals on columns computed
+// from the certificate, other than the one sent to crt.sh as the search.
+func needsCertificate(req *listRequest, searched string) bool {
+	for _, col := range certificateDERColumns {
+		if req.Quals[col] == nil {
+			continue
+		}
+		n := len(req.Quals[col].Quals)
+		if col == searched {
+			n--
+		}
+		if n > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAnyName reports whether any of the names in a search result, which
+// are separated by newlines, matches the query.
+func matchesAnyName(match, query, nameValue string) bool {
+	for _, name := range strings.Split(nameValue, "\n") {
+		if matchesName(match, query, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAnyDomain reports whether any of the names in a search result
+// matches the domain.
+func matchesAnyDomain(domain, nameValue string) bool {
+	for _, name := range strings.Split(nameValue, "\n") {
+		if matchesDomain(domain, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// getCertificate downloads a single certificate by crt.sh ID, returning nil
+// if it does not exist.
+func (b *httpBackend) getCertificate(ctx context.Context, id int64) (*certificateRow, error) {
+	der, err := b.getCertificateDER(ctx, id)
+	if err != nil || der == nil {
+		return nil, err
+	}
+	row := &certificateRow{
+		CertificateID: int(id),
+		Certificate:   der,
+	}
+	if cert, err := x509.ParseCertificate(der); err == nil {
+		row.NotAfter = &cert.NotAfter
+	}
+	return row, nil
+}
+
+// getCertificateDER downloads the DER encoding of a certificate from the
+// ?d=<id> endpoint, returning nil if it does not exist.
+func (b *httpBackend) getCertificateDER(ctx context.Context, id int64) ([]byte, error) {
+	params := url.Values{}
+	params.Set("d", strconv.FormatInt(id, 10))
+
+	body, err := b.get(ctx, params)
+	if err != nil || body == nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	// Certificates are served as PEM, but accept raw DER too.
+	if block, _ := pem.Decode(data); block != nil {
+		return block.Bytes, nil
+	}
+	return data, nil
+}
+
+// get makes a request to the crt.sh web interface. A nil body is returned
+// if the requested item was not found.
+//
+// crt.sh answers with 429 when rate limiting and 5xx when overloaded, so
+// those responses and network errors are retried with backoff.
+func (b *httpBackend) get(ctx context.Context, params url.Values) (io.ReadCloser, error) {
+	u := b.baseURL + "/?" + params.Encode()
+	for attempt := 0; ; attempt++ {
+		body, err := b.getOnce(ctx, u)
+		if err == nil {
+			return body, nil
+		}
+		if attempt >= b.retry.maxAttempts || !isRetryableHTTPError(err) {
+			return nil, err
+		}
+		plugin.Logger(ctx).Warn("crtsh.httpBackend", "retryable_error", err, "attempt", attempt+1)
+		if err := b.retry.wait(ctx, attempt); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (b *httpBackend) getOnce(ctx context.Context, u string) (io.ReadCloser, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("User-Agent", "steampipe-plugin-crtsh")
+
+	plugin.Logger(ctx).Debug("crtsh.httpBackend", "url", u)
+
+	resp, err := b.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &httpStatusError{url: u, status: resp.Status, statusCode: resp.StatusCode}
+	}
+	return resp.Body, nil
+}
+
+// httpStatusError is an unexpected response status from crt.sh.
+type httpStatusError struct {
+	url        string
+	status     string
+	statusCode int
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("crt.sh request %s failed: %s", e.url, e.status)
+}
+
+// isRetryableHTTPError returns true for rate limiting, server errors and the
+// transient network errors retried for the database.
+func isRetryableHTTPError(err error) bool {
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.statusCode == http.StatusTooManyRequests || statusErr.statusCode >= 500
+	}
+	return isRetryableError(err)
+}
@@ -0,0 +1,406 @@
+package crtsh
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/context_key"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/quals"
+)
+
+// testContext returns a context with the logger the backends expect.
+func testContext() context.Context {
+	return context.WithValue(context.Background(), context_key.Logger, hclog.NewNullLogger())
+}
+
+// testCertificate returns the DER encoding of a self-signed certificate.
+func testCertificate(t *testing.T, serial int64, notBefore, notAfter time.Time) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+// newTestHTTPBackend returns an HTTP backend for a stand-in crt.sh server.
+// The requests made to the server are recorded in requests.
+func newTestHTTPBackend(t *testing.T, handler http.HandlerFunc) (b *httpBackend, requests *[]url.Values) {
+	t.Helper()
+	requests = &[]url.Values{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests = append(*requests, r.URL.Query())
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+	config := crtshConfig{HTTPURL: &server.URL}
+	if err := config.validate(); err != nil {
+		t.Fatal(err)
+	}
+	b = newHTTPBackend(config)
+	// Retry without waiting
+	b.retry = retryConfig{maxAttempts: 2}
+	return b, requests
+}
+
+func TestHTTPBackendSearch(t *testing.T) {
+	b, requests := newTestHTTPBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		// One entry per log entry, so certificates repeat
+		w.Write([]byte(`[
+			{"id": 5, "issuer_ca_id": 1, "name_value": "example.com", "not_after": "2030-01-01T00:00:00"},
+			{"id": 9, "issuer_ca_id": 2, "name_value": "example.com\nwww.example.com", "not_after": "2031-01-01T00:00:00"},
+			{"id": 5, "issuer_ca_id": 1, "name_value": "example.com", "not_after": "2030-01-01T00:00:00"},
+			{"id": 7, "issuer_ca_id": 1, "name_value": "api.example.com", "not_after": "2029-01-01T00:00:00"}
+		]`))
+	})
+
+	req := testRequest(tableCrtshCertificate(), testQual("query", "=", "example.com"), testQual("exclude_expired", "=", true))
+	rows := listAll(t, req, b.ListCertificate)
+
+	var ids []int
+	for _, row := range rows {
+		ids = append(ids, row.CertificateID)
+	}
+	if want := []int{9, 7, 5}; !slices.Equal(ids, want) {
+		t.Errorf("got ids %v, want %v, deduplicated newest first", ids, want)
+	}
+	if rows[0].IssuerCaID == nil || *rows[0].IssuerCaID != 2 {
+		t.Errorf("got issuer_ca_id %v, want 2", rows[0].IssuerCaID)
+	}
+	if want := time.Date(2031, 1, 1, 0, 0, 0, 0, time.UTC); rows[0].NotAfter == nil || !rows[0].NotAfter.Equal(want) {
+		t.Errorf("got not_after %v, want %v", rows[0].NotAfter, want)
+	}
+
+	if len(*requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(*requests))
+	}
+	params := (*requests)[0]
+	if params.Get("q") != "example.com" || params.Get("output") != "json" || params.Get("exclude") != "expired" {
+		t.Errorf("got search params %v", params)
+	}
+}
+
+func TestHTTPBackendSearchQueryAndDomain(t *testing.T) {
+	b, requests := newTestHTTPBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[
+			{"id": 9, "issuer_ca_id": 1, "name_value": "www.example.com", "not_after": "2031-01-01T00:00:00"},
+			{"id": 7, "issuer_ca_id": 1, "name_value": "www.other.net", "not_after": "2031-01-01T00:00:00"}
+		]`))
+	})
+
+	req := testRequest(tableCrtshCertificate(), testQual("query", "=", "www"), testQual("domain", "=", "%.other.net"))
+	var ids []int
+	for _, row := range listAll(t, req, b.ListCertificate) {
+		ids = append(ids, row.CertificateID)
+	}
+	if want := []int{7}; !slices.Equal(ids, want) {
+		t.Errorf("got ids %v, want %v", ids, want)
+	}
+	if got := (*requests)[0].Get("q"); got != "www" {
+		t.Errorf("got q %q, want the query www", got)
+	}
+}
+
+func TestHTTPBackendSearchSort(t *testing.T) {
+	b, _ := newTestHTTPBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[
+			{"id": 5, "issuer_ca_id": 1, "name_value": "example.com", "not_after": "2030-01-01T00:00:00"},
+			{"id": 9, "issuer_ca_id": 1, "name_value": "example.com", "not_after": "2031-01-01T00:00:00"},
+			{"id": 7, "issuer_ca_id": 1, "name_value": "example.com", "not_after": "2029-01-01T00:00:00"}
+		]`))
+	})
+
+	req := testRequest(tableCrtshCertificate(), testQual("query", "=", "example.com"))
+	req.SortOrder = []*plugin.SortColumn{{Column: "not_after", Order: plugin.SortAsc}}
+	req.Limit = testLimit(2)
+
+	var ids []int
+	for _, row := range listAll(t, req, b.ListCertificate) {
+		ids = append(ids, row.CertificateID)
+	}
+	if want := []int{7, 5}; !slices.Equal(ids, want) {
+		t.Errorf("got ids %v, want %v", ids, want)
+	}
+}
+
+func TestHTTPBackendSearchQuals(t *testing.T) {
+	b, _ := newTestHTTPBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[
+			{"id": 9, "issuer_ca_id": 2, "name_value": "example.com", "not_before": "2030-01-01T00:00:00", "not_after": "2031-01-01T00:00:00"},
+			{"id": 8, "issuer_ca_id": 1, "name_value": "example.com", "not_before": "2024-01-01T00:00:00", "not_after": "2025-01-01T00:00:00"},
+			{"id": 7, "issuer_ca_id": 1, "name_value": "example.com", "not_before": "2029-01-01T00:00:00", "not_after": "2030-01-01T00:00:00"},
+			{"id": 6, "issuer_ca_id": 1, "name_value": "example.com", "not_before": "2028-01-01T00:00:00", "not_after": "2029-01-01T00:00:00"}
+		]`))
+	})
+
+	tests := []struct {
+		name string
+		req  *listRequest
+		want []int
+	}{
+		{"not_after", withLimit(testRequest(tableCrtshCertificate(), testQual("query", "=", "example.com"), testQual("not_after", ">", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))), 2), []int{9, 7}},
+		{"not_before", testRequest(tableCrtshCertificate(), testQual("query", "=", "example.com"), testQual("not_before", "<", time.Date(2029, 1, 1, 0, 0, 0, 0, time.UTC))), []int{8, 6}},
+		{"issuer_ca_id", withLimit(testRequest(tableCrtshCertificate(), testQual("query", "=", "example.com"), testQual("issuer_ca_id", "=", 1)), 1), []int{8}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ids []int
+			for _, row := range listAll(t, tt.req, b.ListCertificate) {
+				ids = append(ids, row.CertificateID)
+			}
+			if !slices.Equal(ids, tt.want) {
+				t.Errorf("got ids %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPBackendFingerprint(t *testing.T) {
+	b, requests := newTestHTTPBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	})
+
+	listAll(t, testRequest(tableCrtshCertificate(), testQual("fingerprint_sha1", "=", "00:11:22:33:44:55:66:77:88:99:AA:BB:CC:DD:EE:FF:00:11:22:33")), b.ListCertificate)
+	listAll(t, testRequest(tableCrtshCertificate(), testQual("fingerprint_sha256", "=", "not hex")), b.ListCertificate)
+
+	if len(*requests) != 1 {
+		t.Fatalf("got %d requests, want 1 as a fingerprint that is not hex matches nothing", len(*requests))
+	}
+	if got, want := (*requests)[0].Get("q"), "00112233445566778899aabbccddeeff00112233"; got != want {
+		t.Errorf("got q %q, want the canonical fingerprint %q", got, want)
+	}
+}
+
+func TestHTTPBackendSearchCertificateQuals(t *testing.T) {
+	ders := map[string][]byte{
+		"9": testCertificate(t, 0x9999, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2035, 1, 1, 0, 0, 0, 0, time.UTC)),
+		"7": testCertificate(t, 0x7777, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2035, 1, 1, 0, 0, 0, 0, time.UTC)),
+	}
+	b, requests := newTestHTTPBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		if d := r.URL.Query().Get("d"); d != "" {
+			w.Write(ders[d])
+			return
+		}
+		w.Write([]byte(`[
+			{"id": 9, "issuer_ca_id": 1, "name_value": "example.com", "not_before": "2025-01-01T00:00:00", "not_after": "2035-01-01T00:00:00"},
+			{"id": 7, "issuer_ca_id": 1, "name_value": "example.com", "not_before": "2025-01-01T00:00:00", "not_after": "2035-01-01T00:00:00"}
+		]`))
+	})
+	sha256Of := func(id string) string {
+		sum := sha256.Sum256(ders[id])
+		return hex.EncodeToString(sum[:])
+	}
+	spkiOf := func(id string) string {
+		cert, err := x509.ParseCertificate(ders[id])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		return hex.EncodeToString(sum[:])
+	}
+
+	tests := []struct {
+		name string
+		qual *quals.Qual
+	}{
+		{"fingerprint_sha256", testQual("fingerprint_sha256", "=", strings.ToUpper(sha256Of("7")))},
+		{"serial_number", testQual("serial_number", "=", "77:77")},
+		{"spki_sha256", testQual("spki_sha256", "=", spkiOf("7"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*requests = nil
+			req := withLimit(testRequest(tableCrtshCertificate(), testQual("query", "=", "example.com"), tt.qual), 1)
+			var ids []int
+			for _, row := range listAll(t, req, b.ListCertificate) {
+				ids = append(ids, row.CertificateID)
+			}
+			if want := []int{7}; !slices.Equal(ids, want) {
+				t.Errorf("got ids %v, want %v", ids, want)
+			}
+			if len(*requests) != 3 {
+				t.Errorf("got %d requests, want the search and a download per result", len(*requests))
+			}
+		})
+	}
+
+	// The searched fingerprint is matched by crt.sh, so nothing is downloaded
+	*requests = nil
+	listAll(t, testRequest(tableCrtshCertificate(), testQual("fingerprint_sha256", "=", sha256Of("9"))), b.ListCertificate)
+	if len(*requests) != 1 {
+		t.Errorf("got %d requests for a fingerprint search, want 1", len(*requests))
+	}
+}
+
+func TestHTTPBackendDownload(t *testing.T) {
+	der := testCertificate(t, 1234, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	b, requests := newTestHTTPBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("d") {
+		case "1":
+			pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+		case "2":
+			w.Write(der)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	for _, tt := range []struct {
+		name string
+		id   int
+		want bool
+	}{
+		{"pem", 1, true},
+		{"der", 2, true},
+		{"not found", 3, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := listAll(t, testRequest(tableCrtshCertificate(), testQual("id", "=", tt.id)), b.ListCertificate)
+			if !tt.want {
+				if len(rows) != 0 {
+					t.Errorf("got %d rows, want none", len(rows))
+				}
+				return
+			}
+			if len(rows) != 1 {
+				t.Fatalf("got %d rows, want 1", len(rows))
+			}
+			if rows[0].CertificateID != tt.id || !bytes.Equal(rows[0].Certificate, der) {
+				t.Errorf("got certificate %d with %d bytes, want %d with the test certificate", rows[0].CertificateID, len(rows[0].Certificate), tt.id)
+			}
+			if want := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC); rows[0].NotAfter == nil || !rows[0].NotAfter.Equal(want) {
+				t.Errorf("got not_after %v, want %v", rows[0].NotAfter, want)
+			}
+		})
+	}
+
+	if got := (*requests)[0].Get("d"); got != "1" {
+		t.Errorf("got d=%s, want d=1", got)
+	}
+
+	// The test certificate expired at the start of 2026
+	rows := listAll(t, testRequest(tableCrtshCertificate(), testQual("id", "=", 1), testQual("exclude_expired", "=", true)), b.ListCertificate)
+	if len(rows) != 0 {
+		t.Errorf("got %d rows with exclude_expired, want none", len(rows))
+	}
+}
+
+func TestHTTPBackendErrors(t *testing.T) {
+	b, _ := newTestHTTPBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("q") {
+		case "missing.example.com":
+			http.NotFound(w, r)
+		case "invalid.example.com":
+			w.Write([]byte("<html>"))
+		default:
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+		}
+	})
+
+	rows := listAll(t, testRequest(tableCrtshCertificate(), testQual("query", "=", "missing.example.com")), b.ListCertificate)
+	if len(rows) != 0 {
+		t.Errorf("got %d rows for a search that was not found, want none", len(rows))
+	}
+
+	for _, tt := range []struct {
+		query string
+		want  string
+	}{
+		{"busy.example.com", "503 Service Unavailable"},
+		{"invalid.example.com", "failed to parse crt.sh search results"},
+	} {
+		err := b.ListCertificate(testContext(), testRequest(tableCrtshCertificate(), testQual("query", "=", tt.query)), func(certificateRow) bool { return true })
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("query %s: got error %v, want %q", tt.query, err, tt.want)
+		}
+	}
+
+	if err := b.ListLog(testContext(), testRequest(tableCrtshLog()), func(logRow) bool { return true }); err == nil {
+		t.Error("got no error listing crtsh_log, want unsupported")
+	}
+	if err := b.ListCertificate(testContext(), testRequest(tableCrtshCertificate(), testQual("issuer_ca_id", "=", 1)), func(certificateRow) bool { return true }); err == nil {
+		t.Error("got no error for a search without a supported qual")
+	}
+	err := b.ListCertificate(testContext(), testRequest(tableCrtshCertificate(), testQual("query", "=", "example.com"), testQual("name_type", "=", "dNSName")), func(certificateRow) bool { return true })
+	if err == nil || !strings.Contains(err.Error(), "name_type is not available") {
+		t.Errorf("got error %v for a name_type qual, want not available", err)
+	}
+	for _, qs := range [][]*quals.Qual{
+		{testQual("query", "=", "example"), testQual("organization", "=", "Example Corp Ltd")},
+		{testQual("domain", "=", "example.com"), testQual("email", "=", "admin@example.com")},
+		{testQual("organization", "=", "Example Corp Ltd"), testQual("email", "=", "admin@example.com")},
+	} {
+		err := b.ListCertificate(testContext(), testRequest(tableCrtshCertificate(), qs...), func(certificateRow) bool { return true })
+		if err == nil || !strings.Contains(err.Error(), "cannot be combined") {
+			t.Errorf("got error %v for %s and %s, want cannot be combined", err, qs[0].Column, qs[1].Column)
+		}
+	}
+	err = b.ListCertificate(testContext(), testRequest(tableCrtshCertificate(), testQual("domain", "=", "example.com"), testQual("match", "=", "exact")), func(certificateRow) bool { return true })
+	if err == nil || !strings.Contains(err.Error(), "match only applies to a query") {
+		t.Errorf("got error %v for match without query, want match only applies to a query", err)
+	}
+}
+
+func TestHTTPBackendRetry(t *testing.T) {
+	for _, tt := range []struct {
+		status   int
+		requests int
+	}{
+		{http.StatusTooManyRequests, 2},
+		{http.StatusServiceUnavailable, 2},
+		{http.StatusBadRequest, 1},
+	} {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			failed := false
+			b, requests := newTestHTTPBackend(t, func(w http.ResponseWriter, r *http.Request) {
+				if !failed {
+					failed = true
+					http.Error(w, "failed", tt.status)
+					return
+				}
+				w.Write([]byte(`[]`))
+			})
+			err := b.ListCertificate(testContext(), testRequest(tableCrtshCertificate(), testQual("query", "=", "example.com")), func(certificateRow) bool { return true })
+			if tt.requests > 1 && err != nil {
+				t.Errorf("got error %v, want the retry to succeed", err)
+			}
+			if tt.requests == 1 && err == nil {
+				t.Error("got no error, want the status not to be retried")
+			}
+			if len(*requests) != tt.requests {
+				t.Errorf("got %d requests, want %d", len(*requests), tt.requests)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package crtsh
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// memoryBackend serves fixed rows from memory, which makes it suitable for
+// exercising table behaviour without a network. Quals and the sort order are
+// applied as the postgres backend would, as Steampipe relies on the backend
+// for both when they are pushed down with a limit.
+type memoryBackend struct {
+	Cas          []caRow          `json:"ca"`
+	CaIssuers    []caIssuerRow    `json:"ca_issuer"`
+	Certificates []certificateRow `json:"certificate"`
+	Logs         []logRow         `json:"log"`
+	LogEntries   []logEntryRow    `json:"log_entry"`
+}
+
+// loadMemoryBackend reads the rows for a memory backend from a JSON file with
+// one array of rows per table, e.g. {"ca": [...], "log": [...]}.
+func loadMemoryBackend(path string) (*memoryBackend, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture file: %w", err)
+	}
+	b := &memoryBackend{}
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, fmt.Errorf("failed to parse fixture file %s: %w", path, err)
+	}
+	return b, nil
+}
+
+func (b *memoryBackend) ListCa(_ context.Context, req *listRequest, fn func(caRow) bool) error {
+	rows := filterRows(b.Cas, req, caColumns, rowValue[caRow])
+	return streamRows(sortRows(rows, req, caColumns), fn)
+}
+
+func (b *memoryBackend) ListCaIssuer(_ context.Context, req *listRequest, fn func(caIssuerRow) bool) error {
+	rows := filterRows(b.CaIssuers, req, caIssuerColumns, rowValue[caIssuerRow])
+	return streamRows(sortRows(rows, req, caIssuerColumns), fn)
+}
+
+func (b *memoryBackend) ListCertificate(_ context.Context, req *listRequest, fn func(certificateRow) bool) error {
+	match, err := certificateMatch(req)
+	if err != nil {
+		return err
+	}
+	// There is a row per identity, but a certificate is returned once as in
+	// the distinct on (certificate_id) of the postgres backend.
+	seen := map[int]bool{}
+	var rows []certificateRow
+	for _, row := range filterRows(b.Certificates, req, certificateColumns, certificateValue) {
+		if !seen[row.CertificateID] && matchesCertificateSearch(req, match, row) {
+			seen[row.CertificateID] = true
+			rows = append(rows, row)
+		}
+	}
+	// Newest first, as for the postgres backend
+	slices.SortStableFunc(rows, func(a, b certificateRow) int { return cmp.Compare(b.CertificateID, a.CertificateID) })
+	return streamRows(sortRows(rows, req, certificateColumns), fn)
+}
+
+// matchesCertificateSearch reports whether a row matches the search quals of
+// crtsh_certificate, which are not columns of the certificate. There is no
+// full text index in memory, so full text queries match substrings.
+func matchesCertificateSearch(req *listRequest, match string, row certificateRow) bool {
+	if qual := equalsQual(req, "query"); qual != nil {
+		if match == "" || match == matchFullText {
+			match = matchSubstring
+		}
+		if !matchesAnyName(match, qual.Value.GetStringValue(), row.NameValue) {
+			return false
+		}
+	}
+	if qual := equalsQual(req, "domain"); qual != nil && !matchesAnyDomain(qual.Value.GetStringValue(), row.NameValue) {
+		return false
+	}
+	if qual := equalsQual(req, "organization"); qual != nil {
+		if row.NameType != "organizationName" || !strings.EqualFold(row.NameValue, qual.Value.GetStringValue()) {
+			return false
+		}
+	}
+	if qual := equalsQual(req, "email"); qual != nil {
+		if (row.NameType != "emailAddress" && row.NameType != "rfc822Name") || !strings.EqualFold(row.NameValue, qual.Value.GetStringValue()) {
+			return false
+		}
+	}
+	return !excludedExpired(req, row)
+}
+
+func (b *memoryBackend) ListLog(_ context.Context, req *listRequest, fn func(logRow) bool) error {
+	rows := filterRows(b.Logs, req, logColumns, rowValue[logRow])
+	return streamRows(sortRows(rows, req, logColumns), fn)
+}
+
+func (b *memoryBackend) ListLogEntry(_ context.Context, req *listRequest, fn func(logEntryRow) bool) error {
+	rows := filterRows(b.LogEntries, req, logEntryColumns, rowValue[logEntryRow])
+	return streamRows(sortRows(rows, req, logEntryColumns), fn)
+}
+
+func (b *memoryBackend) Close() error {
+	return nil
+}
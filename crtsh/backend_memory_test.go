@@ -0,0 +1,316 @@
+package crtsh
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/quals"
+)
+
+// testRequest returns a list request for the table with the given quals.
+func testRequest(table *plugin.Table, qs ...*quals.Qual) *listRequest {
+	req := &listRequest{Table: table.Name, Columns: table.Columns, Quals: plugin.KeyColumnQualMap{}}
+	for _, q := range qs {
+		if req.Quals[q.Column] == nil {
+			req.Quals[q.Column] = &plugin.KeyColumnQuals{Name: q.Column}
+		}
+		req.Quals[q.Column].Quals = append(req.Quals[q.Column].Quals, q)
+	}
+	return req
+}
+
+func testQual(column, operator string, value interface{}) *quals.Qual {
+	return &quals.Qual{Column: column, Operator: operator, Value: testValue(value)}
+}
+
+// testValue converts a Go value to a qual value, with a slice becoming a list
+// value as for "in (...)".
+func testValue(v interface{}) *proto.QualValue {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case int:
+		return &proto.QualValue{Value: &proto.QualValue_Int64Value{Int64Value: int64(v)}}
+	case string:
+		return &proto.QualValue{Value: &proto.QualValue_StringValue{StringValue: v}}
+	case bool:
+		return &proto.QualValue{Value: &proto.QualValue_BoolValue{BoolValue: v}}
+	case time.Time:
+		return &proto.QualValue{Value: &proto.QualValue_TimestampValue{TimestampValue: timestamppb.New(v)}}
+	case []interface{}:
+		list := &proto.QualValueList{}
+		for _, lv := range v {
+			list.Values = append(list.Values, testValue(lv))
+		}
+		return &proto.QualValue{Value: &proto.QualValue_ListValue{ListValue: list}}
+	default:
+		panic("unsupported qual value type")
+	}
+}
+
+func testLimit(n int64) *int64 {
+	return &n
+}
+
+// listAll collects the rows of a list call, stopping at the limit of the
+// request as the table list functions do.
+func listAll[T any](t *testing.T, req *listRequest, list func(context.Context, *listRequest, func(T) bool) error) []T {
+	t.Helper()
+	rows := []T{}
+	err := list(testContext(), req, func(row T) bool {
+		rows = append(rows, row)
+		return req.Limit == nil || int64(len(rows)) < *req.Limit
+	})
+	if err != nil {
+		t.Fatalf("list %s: %v", req.Table, err)
+	}
+	return rows
+}
+
+func loadTestMemoryBackend(t *testing.T) *memoryBackend {
+	t.Helper()
+	b, err := loadMemoryBackend("testdata/memory.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestMemoryBackendListCa(t *testing.T) {
+	b := loadTestMemoryBackend(t)
+
+	tests := []struct {
+		name string
+		req  *listRequest
+		want []int
+	}{
+		{
+			name: "no quals",
+			req:  testRequest(tableCrtshCa()),
+			want: []int{1, 2, 5, 7},
+		},
+		{
+			name: "limit applies after quals",
+			req: func() *listRequest {
+				req := testRequest(tableCrtshCa(), testQual("id", "=", 5))
+				req.Limit = testLimit(1)
+				return req
+			}(),
+			want: []int{5},
+		},
+		{
+			name: "range",
+			req:  testRequest(tableCrtshCa(), testQual("id", ">", 1), testQual("id", "<=", 5)),
+			want: []int{2, 5},
+		},
+		{
+			name: "in list",
+			req:  testRequest(tableCrtshCa(), testQual("id", "=", []interface{}{2, 7, 9})),
+			want: []int{2, 7},
+		},
+		{
+			name: "not in list",
+			req:  testRequest(tableCrtshCa(), testQual("id", "<>", []interface{}{2, 7})),
+			want: []int{1, 5},
+		},
+		{
+			name: "ilike",
+			req:  testRequest(tableCrtshCa(), testQual("name", "~~*", "%steampipe test ca")),
+			want: []int{1},
+		},
+		{
+			name: "not like",
+			req:  testRequest(tableCrtshCa(), testQual("name", "!~~", "%Steampipe%")),
+			want: []int{2, 5},
+		},
+		{
+			name: "regex",
+			req:  testRequest(tableCrtshCa(), testQual("name", "~", "CN=.* CA$")),
+			want: []int{1, 2, 5},
+		},
+		{
+			name: "is null",
+			req:  testRequest(tableCrtshCa(), testQual("num_certs_issued", "is null", nil)),
+			want: []int{5},
+		},
+		{
+			name: "comparison excludes null",
+			req:  testRequest(tableCrtshCa(), testQual("num_certs_issued", "<", 10)),
+			want: []int{1, 2},
+		},
+		{
+			name: "bool",
+			req:  testRequest(tableCrtshCa(), testQual("linting_applies", "=", false)),
+			want: []int{2},
+		},
+		{
+			name: "sorted with nulls first descending",
+			req: func() *listRequest {
+				req := testRequest(tableCrtshCa())
+				req.SortOrder = []*plugin.SortColumn{{Column: "num_certs_issued", Order: plugin.SortDesc}}
+				req.Limit = testLimit(3)
+				return req
+			}(),
+			want: []int{5, 7, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int
+			for _, row := range listAll(t, tt.req, b.ListCa) {
+				got = append(got, row.ID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got ids %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryBackendListLogEntry(t *testing.T) {
+	b := loadTestMemoryBackend(t)
+
+	tests := []struct {
+		name string
+		req  *listRequest
+		want []int
+	}{
+		{
+			name: "certificate in list",
+			req:  testRequest(tableCrtshLogEntry(), testQual("certificate_id", "=", []interface{}{101, 102})),
+			want: []int{10, 11, 7},
+		},
+		{
+			name: "log and entry range",
+			req:  testRequest(tableCrtshLogEntry(), testQual("ct_log_id", "=", 1), testQual("entry_id", ">", 10)),
+			want: []int{11, 12},
+		},
+		{
+			name: "timestamp",
+			req:  testRequest(tableCrtshLogEntry(), testQual("entry_timestamp", ">=", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))),
+			want: []int{11, 7},
+		},
+		{
+			name: "timestamp is null",
+			req:  testRequest(tableCrtshLogEntry(), testQual("entry_timestamp", "is null", nil)),
+			want: []int{12},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int
+			for _, row := range listAll(t, tt.req, b.ListLogEntry) {
+				got = append(got, row.EntryID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got entry ids %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryBackendListCertificate(t *testing.T) {
+	b := loadTestMemoryBackend(t)
+
+	tests := []struct {
+		name string
+		req  *listRequest
+		want []int
+	}{
+		{
+			name: "query",
+			req:  testRequest(tableCrtshCertificate(), testQual("query", "=", "example.com")),
+			want: []int{104, 103, 102, 101},
+		},
+		{
+			name: "query with limit and not_after",
+			req: func() *listRequest {
+				req := testRequest(tableCrtshCertificate(), testQual("query", "=", "example.com"), testQual("not_after", ">", time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)))
+				req.Limit = testLimit(1)
+				return req
+			}(),
+			want: []int{104},
+		},
+		{
+			name: "match suffix",
+			req:  testRequest(tableCrtshCertificate(), testQual("query", "=", "example.com"), testQual("match", "=", "suffix")),
+			want: []int{102, 101},
+		},
+		{
+			name: "subdomains",
+			req:  testRequest(tableCrtshCertificate(), testQual("domain", "=", "%.example.com")),
+			want: []int{102, 101},
+		},
+		{
+			name: "organization",
+			req:  testRequest(tableCrtshCertificate(), testQual("organization", "=", "example corp ltd")),
+			want: []int{104},
+		},
+		{
+			name: "email",
+			req:  testRequest(tableCrtshCertificate(), testQual("email", "=", "admin@example.com")),
+			want: []int{104},
+		},
+		{
+			name: "serial number",
+			req:  testRequest(tableCrtshCertificate(), testQual("serial_number", "=", "8f00112233445566")),
+			want: []int{102},
+		},
+		{
+			name: "not_before window",
+			req:  testRequest(tableCrtshCertificate(), testQual("issuer_ca_id", "=", 1), testQual("not_before", ">=", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)), testQual("not_before", "<", time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC))),
+			want: []int{103, 102},
+		},
+		{
+			name: "exclude expired",
+			req:  testRequest(tableCrtshCertificate(), testQual("query", "=", "example"), testQual("exclude_expired", "=", true)),
+			want: []int{104, 103, 102},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int
+			for _, row := range listAll(t, tt.req, b.ListCertificate) {
+				got = append(got, row.CertificateID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got ids %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchesPattern(t *testing.T) {
+	tests := []struct {
+		operator, pattern, s string
+		want                 bool
+	}{
+		{"~~", "a%c", "abbbc", true},
+		{"~~", "a_c", "abc", true},
+		{"~~", "a_c", "abbc", false},
+		{"~~", "A%", "abc", false},
+		{"~~*", "A%", "abc", true},
+		{"~~", `100\%`, "100%", true},
+		{"~~", `100\%`, "1000", false},
+		{"~~", "a.c", "abc", false},
+		{"!~~", "a%", "abc", false},
+		{"~", "^a.c$", "abc", true},
+		{"~*", "^A", "abc", true},
+		{"!~*", "^A", "abc", false},
+		{"~", "(", "(", false},
+	}
+	for _, tt := range tests {
+		if got := matchesPattern(tt.operator, tt.pattern, tt.s); got != tt.want {
+			t.Errorf("matchesPattern(%q, %q, %q) = %v, want %v", tt.operator, tt.pattern, tt.s, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,575 @@
+package crtsh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/quals"
+)
+
+// postgresBackend queries a certwatch database directly, either the public
+// crt.sh guest database or a self-hosted replica.
+type postgresBackend struct {
+	db               *sqlx.DB
+	retry            retryConfig
+	statementTimeout time.Duration
+	onRowError       string
+	pageSize         int64
+}
+
+func newPostgresBackend(ctx context.Context, config crtshConfig) (*postgresBackend, error) {
+	db, err := sqlx.ConnectContext(ctx, "postgres", config.connectionString())
+	if err != nil {
+		plugin.Logger(ctx).Error("crtsh.newPostgresBackend", "connection_error", err)
+		return nil, err
+	}
+
+	pool := config.poolConfig()
+	db.SetMaxOpenConns(pool.maxOpen)
+	db.SetMaxIdleConns(pool.maxIdle)
+	db.SetConnMaxLifetime(pool.maxLifetime)
+	db.SetConnMaxIdleTime(pool.maxIdleTime)
+
+	b := &postgresBackend{
+		db:               db,
+		retry:            newRetryConfig(config),
+		statementTimeout: config.statementTimeout(),
+		onRowError:       onRowErrorSkip,
+		pageSize:         config.pageSize(),
+	}
+	if config.OnRowError != nil {
+		b.onRowError = *config.OnRowError
+	}
+	return b, nil
+}
+
+func (b *postgresBackend) Ping(ctx context.Context) error {
+	return b.db.PingContext(ctx)
+}
+
+func (b *postgresBackend) Close() error {
+	return b.db.Close()
+}
+
+// Key columns of each table, mapped to the SQL they filter on.
+var (
+	caColumns = []sqlColumn{
+		{Name: "id", Type: proto.ColumnType_INT},
+		{Name: "name", Type: proto.ColumnType_STRING},
+		{Name: "num_certs_issued", Type: proto.ColumnType_INT},
+		{Name: "num_precerts_issued", Type: proto.ColumnType_INT},
+		{Name: "num_certs_expired", Type: proto.ColumnType_INT},
+		{Name: "num_precerts_expired", Type: proto.ColumnType_INT},
+		{Name: "linting_applies", Type: proto.ColumnType_BOOL},
+	}
+	caIssuerColumns = []sqlColumn{
+		{Name: "ca_id", Type: proto.ColumnType_INT},
+		{Name: "next_check_due", Type: proto.ColumnType_TIMESTAMP},
+		{Name: "last_checked", Type: proto.ColumnType_TIMESTAMP},
+		{Name: "url", Type: proto.ColumnType_STRING},
+		{Name: "result", Type: proto.ColumnType_STRING},
+		{Name: "first_certificate_id", Type: proto.ColumnType_INT},
+		{Name: "is_active", Type: proto.ColumnType_BOOL},
+		{Name: "content_type", Type: proto.ColumnType_STRING},
+	}
+	certificateColumns = []sqlColumn{
+		{Name: "id", Expr: "certificate_id", Type: proto.ColumnType_INT},
+		{Name: "not_after", Expr: "x509_notAfter(certificate)", Type: proto.ColumnType_TIMESTAMP},
+		{Name: "not_before", Expr: "x509_notBefore(certificate)", Type: proto.ColumnType_TIMESTAMP},
+		{Name: "issuer_ca_id", Type: proto.ColumnType_INT},
+		{Name: "name_type", Type: proto.ColumnType_STRING},
+		{Name: "fingerprint_sha1", Expr: "digest(certificate, 'sha1')", Type: proto.ColumnType_STRING, Decode: decodeHex},
+		{Name: "fingerprint_sha256", Expr: "digest(certificate, 'sha256')", Type: proto.ColumnType_STRING, Decode: decodeHex},
+		{Name: "serial_number", Expr: "x509_serialNumber(certificate)", Type: proto.ColumnType_STRING, Decode: decodeSerialNumber},
+		{Name: "spki_sha256", Expr: "digest(x509_publicKey(certificate), 'sha256')", Type: proto.ColumnType_STRING, Decode: decodeHex},
+	}
+	logColumns = []sqlColumn{
+		{Name: "id", Type: proto.ColumnType_INT},
+		{Name: "operator", Type: proto.ColumnType_STRING},
+		{Name: "is_active", Type: proto.ColumnType_BOOL},
+		{Name: "latest_update", Type: proto.ColumnType_TIMESTAMP},
+		{Name: "latest_sth_timestamp", Type: proto.ColumnType_TIMESTAMP},
+		{Name: "mmd_in_seconds", Type: proto.ColumnType_INT},
+		{Name: "tree_size", Type: proto.ColumnType_INT},
+		{Name: "batch_size", Type: proto.ColumnType_INT},
+		{Name: "chunk_size", Type: proto.ColumnType_INT},
+		{Name: "google_uptime", Type: proto.ColumnType_STRING},
+		{Name: "chrome_version_added", Type: proto.ColumnType_INT},
+		{Name: "chrome_inclusion_status", Type: proto.ColumnType_STRING},
+		{Name: "chrome_issue_number", Type: proto.ColumnType_INT},
+		{Name: "chrome_final_tree_size", Type: proto.ColumnType_INT},
+		{Name: "chrome_disqualified_at", Type: proto.ColumnType_TIMESTAMP},
+		{Name: "apple_inclusion_status", Type: proto.ColumnType_STRING},
+		{Name: "apple_last_status_change", Type: proto.ColumnType_TIMESTAMP},
+	}
+	logEntryColumns = []sqlColumn{
+		{Name: "certificate_id", Type: proto.ColumnType_INT},
+		{Name: "entry_id", Type: proto.ColumnType_INT},
+		{Name: "entry_timestamp", Type: proto.ColumnType_TIMESTAMP},
+		{Name: "ct_log_id", Type: proto.ColumnType_INT},
+	}
+)
+
+func (b *postgresBackend) ListCa(ctx context.Context, req *listRequest, fn func(caRow) bool) error {
+	return queryPages(ctx, b, req, caQuery, caColumns, caKeyset, fn)
+}
+
+// caQuery builds the query of CAs for the quals of the request.
+func caQuery(req *listRequest) *queryBuilder {
+
+	// Use a CTE query to setup the column names we filter on.
+	//
+	// Note: the last_not_after and next_not_after fields appear to be related to
+	// crt.sh backend functionality to maintain the expired certs count. I
+	// believe they are tracking timestamps to use when searching the database
+	// and updating those counts. So, they are not included in our results.
+	//
+	// If using the *_not_after columns then Some rows (2 of 236k on 2-Jun-2022)
+	// have `infinity` as the value here, which does not compile properly into a
+	// time.Time.  They will be logged as errors, but are ignored because of this
+	// decision. A string mapping would just be too inconvenient relative to the
+	// value.
+	//
+	return newQueryBuilder("ca_expanded", "*").With("ca_expanded", `
+		select
+			id,
+			num_issued[1] as num_certs_issued,
+			num_issued[2] as num_precerts_issued,
+			num_expired[1] as num_certs_expired,
+			num_expired[2] as num_precerts_expired,
+			-- last_not_after,
+			-- next_not_after,
+			linting_applies,
+			name
+		from ca
+	`).WhereQuals(req, caColumns)
+}
+
+func (b *postgresBackend) ListCaIssuer(ctx context.Context, req *listRequest, fn func(caIssuerRow) bool) error {
+	return queryRows(ctx, b, req, caIssuerQuery(req), nil, fn)
+}
+
+// caIssuerQuery builds the query of CA issuers for the quals, sort order and
+// limit of the request.
+func caIssuerQuery(req *listRequest) *queryBuilder {
+	qb := newQueryBuilder("ca_issuer",
+		"ca_id",
+		"url",
+		"result",
+		"to_jsonb(ca_certificate_ids) as ca_certificate_ids",
+		"first_certificate_id",
+		"is_active",
+		"content_type",
+		"next_check_due",
+		"last_checked",
+	)
+
+	return qb.WhereQuals(req, caIssuerColumns).OrderBySort(req, caIssuerColumns).Limit(req.Limit)
+}
+
+func (b *postgresBackend) ListCertificate(ctx context.Context, req *listRequest, fn func(certificateRow) bool) error {
+	qb, err := certificateQuery(req)
+	if err != nil {
+		return err
+	}
+	return queryRows(ctx, b, req, qb, nil, fn)
+}
+
+// certificateQuery builds the search of certificate identities for the quals
+// of the request.
+func certificateQuery(req *listRequest) (*queryBuilder, error) {
+	qb := newQueryBuilder("certificate_and_identities",
+		"certificate_id",
+		"issuer_ca_id",
+		"name_type",
+		"name_value",
+		"certificate",
+		"x509_notAfter(certificate) as not_after",
+	).DistinctOn("certificate_id")
+
+	qb.WhereQuals(req, certificateColumns)
+
+	match, err := certificateMatch(req)
+	if err != nil {
+		return nil, err
+	}
+	if qual := equalsQual(req, "query"); qual != nil {
+		query := qb.Arg(qual.Value.GetStringValue())
+		// The full text index of identities narrows the search for every mode
+		// except substring, which cannot use it.
+		fullText := fmt.Sprintf("plainto_tsquery('certwatch', %s) @@ identities(certificate)", query)
+		switch match {
+		case matchExact:
+			qb.Where(fullText)
+			qb.Where(fmt.Sprintf("lower(name_value) = lower(%s)", query))
+		case matchSuffix:
+			qb.Where(fullText)
+			qb.Where(fmt.Sprintf("(lower(name_value) = lower(%[1]s) or right(lower(name_value), length(%[1]s) + 1) = '.' || lower(%[1]s))", query))
+		case matchSubstring:
+			qb.Where(fmt.Sprintf("name_value ilike ('%%' || %s || '%%')", query))
+		case matchFullText:
+			qb.Where(fullText)
+		default:
+			qb.Where(fullText)
+			qb.Where(fmt.Sprintf("name_value ilike ('%%' || %s || '%%')", query))
+		}
+	}
+
+	// crt.sh indexes identities by their reversed name, so all subdomains of
+	// a domain are a prefix match on the index.
+	if qual := equalsQual(req, "domain"); qual != nil {
+		domain := strings.ToLower(qual.Value.GetStringValue())
+		if strings.HasPrefix(domain, domainWildcard) {
+			pattern := likeEscaper.Replace(reverseString(domain[1:])) + "%"
+			qb.Where(fmt.Sprintf("reverse(lower(name_value)) like %s", qb.Arg(pattern)))
+		} else {
+			qb.Where(fmt.Sprintf("reverse(lower(name_value)) = %s", qb.Arg(reverseString(domain))))
+		}
+	}
+
+	// Organization and email identities are searched by type, so they do not
+	// match DNS names that happen to contain the value.
+	if qual := equalsQual(req, "organization"); qual != nil {
+		qb.Where("name_type = 'organizationName'")
+		qb.Where(fmt.Sprintf("lower(name_value) = lower(%s)", qb.Arg(qual.Value.GetStringValue())))
+	}
+	if qual := equalsQual(req, "email"); qual != nil {
+		qb.Where("name_type in ('emailAddress', 'rfc822Name')")
+		qb.Where(fmt.Sprintf("lower(name_value) = lower(%s)", qb.Arg(qual.Value.GetStringValue())))
+	}
+
+	// Same as exclude=expired in the crt.sh search
+	if qual := equalsQual(req, "exclude_expired"); qual != nil && qual.Value.GetBoolValue() {
+		qb.Where("x509_notAfter(certificate) > now() at time zone 'UTC'")
+	}
+
+	// distinct on (certificate_id) must be ordered by certificate_id first, so
+	// any other sort is applied to the distinct rows, using their not_after
+	// column.
+	//
+	// Otherwise the rows are returned newest first, so a limit gives the most
+	// recent certificates rather than an arbitrary set of them.
+	if len(req.SortOrder) > 0 {
+		qb = qb.Subquery("c").OrderBySort(req, nil)
+	} else {
+		qb.OrderBy("certificate_id desc")
+	}
+
+	return qb.Limit(req.Limit), nil
+}
+
+func (b *postgresBackend) ListLog(ctx context.Context, req *listRequest, fn func(logRow) bool) error {
+	return queryPages(ctx, b, req, logQuery, logColumns, logKeyset, fn)
+}
+
+// logQuery builds the query of logs for the quals of the request.
+func logQuery(req *listRequest) *queryBuilder {
+	return newQueryBuilder("ct_log",
+		"id",
+		"operator",
+		"url",
+		"name",
+		"public_key",
+		"is_active",
+		"latest_update",
+		"latest_sth_timestamp",
+		"mmd_in_seconds",
+		"tree_size",
+		"batch_size",
+		"chunk_size",
+		"google_uptime",
+		"chrome_version_added",
+		"chrome_inclusion_status",
+		"chrome_issue_number",
+		"chrome_final_tree_size",
+		"chrome_disqualified_at",
+		"apple_inclusion_status",
+		"apple_last_status_change",
+	).WhereQuals(req, logColumns)
+}
+
+func (b *postgresBackend) ListLogEntry(ctx context.Context, req *listRequest, fn func(logEntryRow) bool) error {
+	return queryPages(ctx, b, req, logEntryQuery, logEntryColumns, logEntryKeyset, fn)
+}
+
+// logEntryQuery builds the query of log entries for the quals of the request.
+func logEntryQuery(req *listRequest) *queryBuilder {
+	return newQueryBuilder("ct_log_entry",
+		"certificate_id",
+		"entry_id",
+		"entry_timestamp",
+		"ct_log_id",
+	).WhereQuals(req, logEntryColumns)
+}
+
+// likeEscaper escapes the wildcards of a like pattern.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func reverseString(s string) string {
+	r := []rune(s)
+	slices.Reverse(r)
+	return string(r)
+}
+
+// keyset is the primary key of a table, used to page through it.
+type keyset[T any] struct {
+	columns []string
+	values  func(T) []interface{}
+}
+
+var (
+	caKeyset = keyset[caRow]{
+		columns: []string{"id"},
+		values:  func(r caRow) []interface{} { return []interface{}{int64(r.ID)} },
+	}
+	logKeyset = keyset[logRow]{
+		columns: []string{"id"},
+		values:  func(r logRow) []interface{} { return []interface{}{int64(r.ID)} },
+	}
+	logEntryKeyset = keyset[logEntryRow]{
+		columns: []string{"ct_log_id", "entry_id"},
+		values:  func(r logEntryRow) []interface{} { return []interface{}{int64(r.CtLogID), int64(r.EntryID)} },
+	}
+)
+
+// page adds the condition, order and limit for the page of size rows after
+// a key, or the first page for a nil key.
+func (k keyset[T]) page(qb *queryBuilder, after []interface{}, size int64) *queryBuilder {
+	qb.After(k.columns, after)
+	for _, col := range k.columns {
+		qb.OrderBy(col)
+	}
+	return qb.Limit(&size)
+}
+
+// pageRows tracks the rows fetched by a page, including rows that were
+// skipped because they could not be read. The next page starts after the key
+// of the last row fetched, and a page is the last one when fewer rows than its
+// size were fetched, so a skipped row neither ends the scan early nor is
+// fetched again.
+type pageRows struct {
+	// columns of the keyset of the table
+	columns []string
+	// after is the key of the last row fetched
+	after []interface{}
+	// fetched is the number of rows fetched by the page
+	fetched int64
+}
+
+// skip records the key of a row that could not be scanned into its struct.
+// The row is scanned again as generic values to read its key.
+func (p *pageRows) skip(rows *sqlx.Rows) {
+	values := map[string]interface{}{}
+	if err := rows.MapScan(values); err != nil {
+		return
+	}
+	after := make([]interface{}, len(p.columns))
+	for i, col := range p.columns {
+		v, ok := values[col]
+		if !ok || v == nil {
+			return
+		}
+		after[i] = v
+	}
+	p.after = after
+}
+
+// queryPages runs the query built by query a page of page_size rows at a
+// time, ordered by the keyset of the table. Each page starts after the key of
+// the last row of the previous one, so every statement is short and rows are
+// streamed to fn seamlessly across pages.
+//
+// A page that fails with a transient error after returning rows is resumed
+// from the last row, rather than restarting the whole scan.
+//
+// Paging is not used when a sort order is pushed down, as the rows must then
+// be returned in that order instead.
+func queryPages[T any](ctx context.Context, b *postgresBackend, req *listRequest, query func(*listRequest) *queryBuilder, columns []sqlColumn, key keyset[T], fn func(T) bool) error {
+	if b.pageSize <= 0 || len(req.SortOrder) > 0 {
+		return queryRows(ctx, b, req, query(req).OrderBySort(req, columns).Limit(req.Limit), nil, fn)
+	}
+
+	page := &pageRows{columns: key.columns}
+	var remaining *int64
+	if req.Limit != nil {
+		limit := *req.Limit
+		remaining = &limit
+	}
+
+	for attempt := 0; ; {
+		size := b.pageSize
+		if remaining != nil && *remaining < size {
+			size = *remaining
+		}
+		qb := key.page(query(req), page.after, size)
+
+		var count int64
+		stopped := false
+		err := queryRows(ctx, b, req, qb, page, func(row T) bool {
+			count++
+			page.after = key.values(row)
+			if !fn(row) {
+				stopped = true
+				return false
+			}
+			return true
+		})
+		if remaining != nil {
+			*remaining -= count
+		}
+
+		if err != nil {
+			// queryRows has already retried if the page returned no rows.
+			if count == 0 || attempt >= b.retry.maxAttempts || !isRetryableError(err) {
+				return err
+			}
+			plugin.Logger(ctx).Warn(req.Table+".queryPages", "retryable_error", err, "attempt", attempt+1, "after", page.after)
+			if err := b.retry.wait(ctx, attempt); err != nil {
+				return err
+			}
+			attempt++
+			continue
+		}
+
+		// Stop when fn is done, the limit is reached or the page was short,
+		// i.e. the last one. Skipped rows count towards the page, so a page
+		// with unreadable rows is not mistaken for the last one.
+		if stopped || page.fetched < size || (remaining != nil && *remaining <= 0) {
+			return nil
+		}
+		attempt = 0
+	}
+}
+
+// queryRows runs the query and scans each result row into a T, passing it to
+// fn until the rows are exhausted or fn asks to stop.
+//
+// The queries are read-only, so a query that fails with a transient error is
+// retried with backoff, as long as no rows have been passed to fn yet.
+//
+// The rows fetched are recorded in page, if not nil.
+func queryRows[T any](ctx context.Context, b *postgresBackend, req *listRequest, qb *queryBuilder, page *pageRows, fn func(T) bool) error {
+	q, args := qb.Build()
+
+	plugin.Logger(ctx).Debug(req.Table+".queryRows", "query", regexp.MustCompile(`\s+`).ReplaceAllString(q, " "))
+	plugin.Logger(ctx).Debug(req.Table+".queryRows", "args", args)
+
+	for attempt := 0; ; attempt++ {
+		emitted, err := queryRowsOnce(ctx, b, req, q, args, page, fn)
+		if err == nil {
+			return nil
+		}
+		if isStatementTimeout(err) {
+			return b.statementTimeoutError(req)
+		}
+		if emitted > 0 || attempt >= b.retry.maxAttempts || !isRetryableError(err) {
+			return err
+		}
+		plugin.Logger(ctx).Warn("crtsh.queryRows", "retryable_error", err, "attempt", attempt+1)
+		if err := b.retry.wait(ctx, attempt); err != nil {
+			return err
+		}
+	}
+}
+
+// queryRowsOnce runs the query a single time, returning the number of rows
+// passed to fn.
+//
+// Rows that cannot be scanned are skipped or fail the query depending on the
+// on_row_error setting. Skipped rows are counted and logged, which is the only
+// place they are reported as the SDK has no way to attach them to the query
+// results. An error reading the result set (e.g. a dropped connection) is
+// always returned, so a truncated result is never mistaken for a complete one.
+func queryRowsOnce[T any](ctx context.Context, b *postgresBackend, req *listRequest, q string, args []interface{}, page *pageRows, fn func(T) bool) (emitted int, err error) {
+	// The query is cancelled on the server when the Steampipe query is
+	// cancelled, or when fn asks to stop. Closing the rows without cancelling
+	// would read, and discard, every remaining row.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	rows, err := b.db.QueryxContext(ctx, q, args...)
+	if err != nil {
+		return emitted, err
+	}
+
+	skipped := 0
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil {
+			plugin.Logger(ctx).Warn(req.Table+".queryRows", "close_error", closeErr)
+		}
+		if skipped > 0 {
+			plugin.Logger(ctx).Warn(req.Table+".queryRows", "skipped_rows", skipped, "emitted_rows", emitted, "quals", req.describeQuals())
+		}
+	}()
+
+	if page != nil {
+		page.fetched = 0
+	}
+	for rows.Next() {
+		if page != nil {
+			page.fetched++
+		}
+		var row T
+		if err := rows.StructScan(&row); err != nil {
+			if b.onRowError == onRowErrorFail {
+				return emitted, fmt.Errorf("%s: failed to read row %d: %w", req.Table, emitted+skipped+1, err)
+			}
+			skipped++
+			plugin.Logger(ctx).Error(req.Table+".queryRows", "row_error", err)
+			if page != nil {
+				page.skip(rows)
+			}
+			continue
+		}
+		emitted++
+		if !fn(row) {
+			cancel()
+			return emitted, nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return emitted, fmt.Errorf("%s: result set ended early after %d rows: %w", req.Table, emitted, err)
+	}
+	return emitted, nil
+}
+
+// isStatementTimeout returns true if the server cancelled the query because
+// it ran longer than statement_timeout.
+func isStatementTimeout(err error) bool {
+	var pqErr *pq.Error
+	// query_canceled is also used when the query is cancelled by the client,
+	// so check the message too.
+	return errors.As(err, &pqErr) && pqErr.Code == "57014" && strings.Contains(pqErr.Message, "statement timeout")
+}
+
+func (b *postgresBackend) statementTimeoutError(req *listRequest) error {
+	limit := "the server statement timeout"
+	if b.statementTimeout > 0 {
+		limit = fmt.Sprintf("the statement_timeout of %s", b.statementTimeout)
+	}
+	return fmt.Errorf("%s: query exceeded %s, add more selective quals to narrow the query (quals pushed down: %s)", req.Table, limit, req.describeQuals())
+}
+
+// equalsQual returns the first "=" qual for the column with a single value, if
+// any.
+func equalsQual(req *listRequest, column string) *quals.Qual {
+	if req.Quals[column] == nil {
+		return nil
+	}
+	for _, q := range req.Quals[column].Quals {
+		if q.Operator == "=" && q.Value.GetListValue() == nil {
+			return q
+		}
+	}
+	return nil
+}
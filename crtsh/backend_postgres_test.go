@@ -0,0 +1,118 @@
+package crtsh
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// pageDriver is a database driver serving the keyset pages of a table with
+// id and name columns. A row with a nil name cannot be scanned into a
+// pageTestRow.
+type pageDriver struct {
+	rows    [][]driver.Value
+	queries [][]driver.NamedValue
+}
+
+func (d *pageDriver) Connect(context.Context) (driver.Conn, error) { return pageConn{d}, nil }
+func (d *pageDriver) Driver() driver.Driver                        { return nil }
+
+type pageConn struct{ d *pageDriver }
+
+func (c pageConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c pageConn) Close() error                        { return nil }
+func (c pageConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+// QueryContext takes the arguments of a page, i.e. the limit with or without
+// the key to start after.
+func (c pageConn) QueryContext(_ context.Context, _ string, args []driver.NamedValue) (driver.Rows, error) {
+	c.d.queries = append(c.d.queries, args)
+	var after int64 = -1
+	if len(args) == 2 {
+		after = args[0].Value.(int64)
+	}
+	limit := args[len(args)-1].Value.(int64)
+
+	var page [][]driver.Value
+	for _, row := range c.d.rows {
+		if row[0].(int64) > after && int64(len(page)) < limit {
+			page = append(page, row)
+		}
+	}
+	return &pageDriverRows{rows: page}, nil
+}
+
+type pageDriverRows struct{ rows [][]driver.Value }
+
+func (r *pageDriverRows) Columns() []string { return []string{"id", "name"} }
+func (r *pageDriverRows) Close() error      { return nil }
+func (r *pageDriverRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+type pageTestRow struct {
+	ID   int    `db:"id"`
+	Name string `db:"name"`
+}
+
+var pageTestKeyset = keyset[pageTestRow]{
+	columns: []string{"id"},
+	values:  func(r pageTestRow) []interface{} { return []interface{}{int64(r.ID)} },
+}
+
+func pageTestQuery(*listRequest) *queryBuilder {
+	return newQueryBuilder("t", "id", "name")
+}
+
+func TestQueryPagesSkippedRows(t *testing.T) {
+	d := &pageDriver{}
+	for id := int64(1); id <= 7; id++ {
+		var name driver.Value = "ok"
+		// The whole second page, and the last row of the first, are unreadable
+		if id >= 3 && id <= 6 {
+			name = nil
+		}
+		d.rows = append(d.rows, []driver.Value{id, name})
+	}
+	b := &postgresBackend{
+		db:         sqlx.NewDb(sql.OpenDB(d), "postgres"),
+		onRowError: onRowErrorSkip,
+		pageSize:   3,
+	}
+	defer b.db.Close()
+
+	var ids []int
+	err := queryPages(testContext(), b, testRequest(tableCrtshCa()), pageTestQuery, nil, pageTestKeyset, func(row pageTestRow) bool {
+		ids = append(ids, row.ID)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{1, 2, 7}; !slices.Equal(ids, want) {
+		t.Errorf("got ids %v, want %v", ids, want)
+	}
+
+	var starts []interface{}
+	for _, args := range d.queries {
+		if len(args) == 2 {
+			starts = append(starts, args[0].Value)
+		} else {
+			starts = append(starts, nil)
+		}
+	}
+	if want := []interface{}{nil, int64(3), int64(6)}; !slices.Equal(starts, want) {
+		t.Errorf("got pages starting after %v, want %v", starts, want)
+	}
+}
@@ -0,0 +1,105 @@
+package crtsh
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+)
+
+func testQueryData(connectionName string, config crtshConfig) *plugin.QueryData {
+	return &plugin.QueryData{Connection: &plugin.Connection{Name: connectionName, Config: config}}
+}
+
+func TestGetBackendPerConnection(t *testing.T) {
+	memory, fixture := backendMemory, "testdata/memory.json"
+	config := crtshConfig{Backend: &memory, FixtureFile: &fixture}
+	ctx := testContext()
+	t.Cleanup(func() {
+		closeBackend(ctx, "test_a")
+		closeBackend(ctx, "test_b")
+	})
+
+	a, err := getBackend(ctx, testQueryData("test_a", config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := getBackend(ctx, testQueryData("test_b", config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b {
+		t.Error("connections share a backend, want one each")
+	}
+
+	again, _ := getBackend(ctx, testQueryData("test_a", config))
+	if again != a {
+		t.Error("backend was not reused for an unchanged config")
+	}
+
+	pageSize := 10
+	config.PageSize = &pageSize
+	changed, _ := getBackend(ctx, testQueryData("test_a", config))
+	if changed == a {
+		t.Error("backend was reused after the config changed")
+	}
+}
+
+func TestCheckInterval(t *testing.T) {
+	tests := []struct {
+		fallback bool
+		probes   int
+		want     time.Duration
+	}{
+		{false, 0, time.Minute},
+		{false, 5, time.Minute},
+		{true, 0, time.Minute},
+		{true, 1, 2 * time.Minute},
+		{true, 3, 8 * time.Minute},
+		{true, 6, time.Hour},
+		{true, 100, time.Hour},
+	}
+	for _, tt := range tests {
+		c := &cachedBackend{fallback: tt.fallback, probes: tt.probes}
+		if got := c.checkInterval(); got != tt.want {
+			t.Errorf("checkInterval with fallback %v after %d probes = %s, want %s", tt.fallback, tt.probes, got, tt.want)
+		}
+	}
+}
+
+func TestAutoBackendFallback(t *testing.T) {
+	// Nothing listens on port 1, so the connection is refused
+	auto, host, port := backendAuto, "127.0.0.1", 1
+	b, fallback, err := newBackend(testContext(), crtshConfig{Backend: &auto, Host: &host, Port: &port})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if _, ok := b.(*httpBackend); !ok || !fallback {
+		t.Errorf("got %T with fallback %v, want the HTTP backend as a fallback", b, fallback)
+	}
+}
+
+func TestGetCertificateDERMemory(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	memory, fixture := backendMemory, "testdata/memory.json"
+	config := crtshConfig{Backend: &memory, FixtureFile: &fixture, HTTPURL: &server.URL}
+	ctx := testContext()
+	t.Cleanup(func() { closeBackend(ctx, "test_der") })
+
+	der, err := getCertificateDER(ctx, testQueryData("test_der", config), &plugin.HydrateData{Item: certificateRow{CertificateID: 999}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := der.([]byte); len(b) != 0 || requests != 0 {
+		t.Errorf("got certificate %x after %d requests, want none for a memory row without a certificate", b, requests)
+	}
+}
@@ -0,0 +1,310 @@
+package crtsh
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+)
+
+const (
+	onRowErrorSkip = "skip"
+	onRowErrorFail = "fail"
+)
+
+const (
+	defaultHost     = "crt.sh"
+	defaultPort     = 5432
+	defaultDatabase = "certwatch"
+	defaultUser     = "guest"
+)
+
+type crtshConfig struct {
+	Host           *string `hcl:"host"`
+	Port           *int    `hcl:"port"`
+	Database       *string `hcl:"database"`
+	User           *string `hcl:"user"`
+	Password       *string `hcl:"password"`
+	SSLMode        *string `hcl:"sslmode"`
+	SSLRootCert    *string `hcl:"sslrootcert"`
+	ConnectTimeout *int    `hcl:"connect_timeout"`
+	Backend        *string `hcl:"backend"`
+	FixtureFile    *string `hcl:"fixture_file"`
+	HTTPURL        *string `hcl:"http_url"`
+
+	// StatementTimeout is a duration, e.g. "2m"
+	StatementTimeout *string `hcl:"statement_timeout"`
+
+	OnRowError *string `hcl:"on_row_error"`
+
+	PageSize *int `hcl:"page_size"`
+
+	FixtureMode *string `hcl:"fixture_mode"`
+	FixtureDir  *string `hcl:"fixture_dir"`
+
+	MaxOpenConnections    *int    `hcl:"max_open_connections"`
+	MaxIdleConnections    *int    `hcl:"max_idle_connections"`
+	ConnectionMaxLifetime *string `hcl:"connection_max_lifetime"`
+	ConnectionMaxIdleTime *string `hcl:"connection_max_idle_time"`
+
+	MaxErrorRetryAttempts *int `hcl:"max_error_retry_attempts"`
+	MinErrorRetryDelay    *int `hcl:"min_error_retry_delay"`
+	MaxErrorRetryDelay    *int `hcl:"max_error_retry_delay"`
+}
+
+func ConfigInstance() interface{} {
+	return &crtshConfig{}
+}
+
+// GetConfig :: retrieve and cast connection config from query data
+func GetConfig(connection *plugin.Connection) crtshConfig {
+	if connection == nil || connection.Config == nil {
+		return crtshConfig{}
+	}
+	config, _ := connection.Config.(crtshConfig)
+	return config
+}
+
+// validate checks the connection config, returning an error describing every
+// invalid setting rather than just the first one found.
+func (c crtshConfig) validate() error {
+	var problems []string
+
+	if c.Host != nil && strings.TrimSpace(*c.Host) == "" {
+		problems = append(problems, "host must not be empty")
+	}
+	if c.Port != nil && (*c.Port < 1 || *c.Port > 65535) {
+		problems = append(problems, fmt.Sprintf("port must be between 1 and 65535, got %d", *c.Port))
+	}
+	if c.Database != nil && strings.TrimSpace(*c.Database) == "" {
+		problems = append(problems, "database must not be empty")
+	}
+	if c.User != nil && strings.TrimSpace(*c.User) == "" {
+		problems = append(problems, "user must not be empty")
+	}
+	if c.SSLMode != nil {
+		// These are the modes supported by lib/pq
+		switch *c.SSLMode {
+		case "disable", "require", "verify-ca", "verify-full":
+		default:
+			problems = append(problems, fmt.Sprintf("sslmode must be one of disable, require, verify-ca or verify-full, got %q", *c.SSLMode))
+		}
+	}
+	if c.SSLRootCert != nil {
+		if c.SSLMode != nil && *c.SSLMode == "disable" {
+			problems = append(problems, "sslrootcert cannot be used with sslmode = \"disable\"")
+		}
+		if info, err := os.Stat(*c.SSLRootCert); err != nil {
+			problems = append(problems, fmt.Sprintf("sslrootcert %q cannot be read: %v", *c.SSLRootCert, err))
+		} else if info.IsDir() {
+			problems = append(problems, fmt.Sprintf("sslrootcert %q is a directory, expected a PEM file", *c.SSLRootCert))
+		}
+	}
+	if c.ConnectTimeout != nil && *c.ConnectTimeout < 0 {
+		problems = append(problems, fmt.Sprintf("connect_timeout must be zero (no timeout) or a positive number of seconds, got %d", *c.ConnectTimeout))
+	}
+
+	if c.StatementTimeout != nil {
+		if d, err := time.ParseDuration(*c.StatementTimeout); err != nil {
+			problems = append(problems, fmt.Sprintf("statement_timeout must be a duration such as \"90s\" or \"5m\", got %q", *c.StatementTimeout))
+		} else if d < 0 {
+			problems = append(problems, fmt.Sprintf("statement_timeout must not be negative, got %q", *c.StatementTimeout))
+		}
+	}
+	if c.OnRowError != nil && *c.OnRowError != onRowErrorSkip && *c.OnRowError != onRowErrorFail {
+		problems = append(problems, fmt.Sprintf("on_row_error must be %s or %s, got %q", onRowErrorSkip, onRowErrorFail, *c.OnRowError))
+	}
+	if c.PageSize != nil && *c.PageSize < 0 {
+		problems = append(problems, fmt.Sprintf("page_size must be zero (no paging) or more, got %d", *c.PageSize))
+	}
+	if c.FixtureMode != nil {
+		switch *c.FixtureMode {
+		case fixtureModeRecord, fixtureModeReplay:
+			if c.FixtureDir == nil || strings.TrimSpace(*c.FixtureDir) == "" {
+				problems = append(problems, fmt.Sprintf("fixture_dir is required when fixture_mode = %q", *c.FixtureMode))
+			} else if *c.FixtureMode == fixtureModeReplay {
+				if info, err := os.Stat(*c.FixtureDir); err != nil || !info.IsDir() {
+					problems = append(problems, fmt.Sprintf("fixture_dir %q must be an existing directory of recordings when fixture_mode = %q", *c.FixtureDir, fixtureModeReplay))
+				}
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("fixture_mode must be %s or %s, got %q", fixtureModeRecord, fixtureModeReplay, *c.FixtureMode))
+		}
+	}
+	if c.MaxOpenConnections != nil && *c.MaxOpenConnections < 1 {
+		problems = append(problems, fmt.Sprintf("max_open_connections must be at least 1, got %d", *c.MaxOpenConnections))
+	}
+	if c.MaxIdleConnections != nil && *c.MaxIdleConnections < 0 {
+		problems = append(problems, fmt.Sprintf("max_idle_connections must be zero or more, got %d", *c.MaxIdleConnections))
+	}
+	if c.ConnectionMaxLifetime != nil {
+		if d, err := time.ParseDuration(*c.ConnectionMaxLifetime); err != nil || d < 0 {
+			problems = append(problems, fmt.Sprintf("connection_max_lifetime must be a duration such as \"30m\", got %q", *c.ConnectionMaxLifetime))
+		}
+	}
+	if c.ConnectionMaxIdleTime != nil {
+		if d, err := time.ParseDuration(*c.ConnectionMaxIdleTime); err != nil || d < 0 {
+			problems = append(problems, fmt.Sprintf("connection_max_idle_time must be a duration such as \"5m\", got %q", *c.ConnectionMaxIdleTime))
+		}
+	}
+	if c.MaxErrorRetryAttempts != nil && *c.MaxErrorRetryAttempts < 0 {
+		problems = append(problems, fmt.Sprintf("max_error_retry_attempts must be zero (no retries) or more, got %d", *c.MaxErrorRetryAttempts))
+	}
+	if c.MinErrorRetryDelay != nil && *c.MinErrorRetryDelay < 1 {
+		problems = append(problems, fmt.Sprintf("min_error_retry_delay must be at least 1 millisecond, got %d", *c.MinErrorRetryDelay))
+	}
+	if c.MaxErrorRetryDelay != nil && *c.MaxErrorRetryDelay < 1 {
+		problems = append(problems, fmt.Sprintf("max_error_retry_delay must be at least 1 millisecond, got %d", *c.MaxErrorRetryDelay))
+	}
+	if r := newRetryConfig(c); r.minDelay > r.maxDelay {
+		problems = append(problems, fmt.Sprintf("min_error_retry_delay (%s) must not be greater than max_error_retry_delay (%s)", r.minDelay, r.maxDelay))
+	}
+
+	if c.Backend != nil {
+		switch *c.Backend {
+		case backendPostgres, backendHTTP, backendAuto:
+		case backendMemory:
+			if c.FixtureFile == nil {
+				problems = append(problems, "fixture_file is required when backend = \"memory\"")
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("backend must be one of %s, %s, %s or %s, got %q", backendPostgres, backendHTTP, backendAuto, backendMemory, *c.Backend))
+		}
+	}
+	if c.HTTPURL != nil {
+		if u, err := url.Parse(*c.HTTPURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("http_url must be an absolute http or https URL, got %q", *c.HTTPURL))
+		}
+	}
+	if c.FixtureFile != nil {
+		if _, err := os.Stat(*c.FixtureFile); err != nil {
+			problems = append(problems, fmt.Sprintf("fixture_file %q cannot be read: %v", *c.FixtureFile, err))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid crtsh connection config: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// connectionString builds the lib/pq connection URL for the config, falling
+// back to the public crt.sh guest database for any unset values.
+func (c crtshConfig) connectionString() string {
+	host := defaultHost
+	if c.Host != nil {
+		host = *c.Host
+	}
+	port := defaultPort
+	if c.Port != nil {
+		port = *c.Port
+	}
+	database := defaultDatabase
+	if c.Database != nil {
+		database = *c.Database
+	}
+	user := url.User(defaultUser)
+	if c.User != nil {
+		user = url.User(*c.User)
+	}
+	if c.Password != nil {
+		user = url.UserPassword(user.Username(), *c.Password)
+	}
+
+	params := url.Values{}
+	params.Set("binary_parameters", "yes")
+	if c.SSLMode != nil {
+		params.Set("sslmode", *c.SSLMode)
+	}
+	if c.SSLRootCert != nil {
+		params.Set("sslrootcert", *c.SSLRootCert)
+	}
+	if c.ConnectTimeout != nil {
+		params.Set("connect_timeout", strconv.Itoa(*c.ConnectTimeout))
+	}
+	// Run-time parameters are sent when each session starts, so every pooled
+	// connection gets the timeout.
+	if timeout := c.statementTimeout(); timeout > 0 {
+		params.Set("statement_timeout", strconv.FormatInt(timeout.Milliseconds(), 10))
+	}
+
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     user,
+		Host:     net.JoinHostPort(host, strconv.Itoa(port)),
+		Path:     "/" + database,
+		RawQuery: params.Encode(),
+	}
+	return u.String()
+}
+
+// statementTimeout returns the configured statement_timeout, or zero to use
+// the server default.
+func (c crtshConfig) statementTimeout() time.Duration {
+	if c.StatementTimeout == nil {
+		return 0
+	}
+	d, _ := time.ParseDuration(*c.StatementTimeout)
+	return d
+}
+
+const defaultPageSize = 10000
+
+// pageSize returns the number of rows fetched by each query when scanning a
+// table, or zero to fetch all rows with a single query.
+func (c crtshConfig) pageSize() int64 {
+	if c.PageSize == nil {
+		return defaultPageSize
+	}
+	return int64(*c.PageSize)
+}
+
+// key identifies the config, so a cached backend can be replaced when any
+// setting changes.
+func (c crtshConfig) key() string {
+	// Pointers are marshalled as their values
+	data, _ := json.Marshal(c)
+	return string(data)
+}
+
+const (
+	defaultMaxOpenConnections    = 10
+	defaultMaxIdleConnections    = 2
+	defaultConnectionMaxLifetime = 30 * time.Minute
+	defaultConnectionMaxIdleTime = 5 * time.Minute
+)
+
+type poolConfig struct {
+	maxOpen     int
+	maxIdle     int
+	maxLifetime time.Duration
+	maxIdleTime time.Duration
+}
+
+func (c crtshConfig) poolConfig() poolConfig {
+	p := poolConfig{
+		maxOpen:     defaultMaxOpenConnections,
+		maxIdle:     defaultMaxIdleConnections,
+		maxLifetime: defaultConnectionMaxLifetime,
+		maxIdleTime: defaultConnectionMaxIdleTime,
+	}
+	if c.MaxOpenConnections != nil {
+		p.maxOpen = *c.MaxOpenConnections
+	}
+	if c.MaxIdleConnections != nil {
+		p.maxIdle = *c.MaxIdleConnections
+	}
+	if c.ConnectionMaxLifetime != nil {
+		p.maxLifetime, _ = time.ParseDuration(*c.ConnectionMaxLifetime)
+	}
+	if c.ConnectionMaxIdleTime != nil {
+		p.maxIdleTime, _ = time.ParseDuration(*c.ConnectionMaxIdleTime)
+	}
+	return p
+}
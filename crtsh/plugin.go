@@ -11,13 +11,27 @@ func Plugin(ctx context.Context) *plugin.Plugin {
 	p := &plugin.Plugin{
 		Name:             "steampipe-plugin-crtsh",
 		DefaultTransform: transform.FromGo(),
-		TableMap: map[string]*plugin.Table{
-			"crtsh_ca":          tableCrtshCa(),
-			"crtsh_ca_issuer":   tableCrtshCaIssuer(),
-			"crtsh_certificate": tableCrtshCertificate(),
-			"crtsh_log":         tableCrtshLog(),
-			"crtsh_log_entry":   tableCrtshLogEntry(),
+		ConnectionConfigSchema: &plugin.ConnectionConfigSchema{
+			NewInstance: ConfigInstance,
 		},
+		ConnectionConfigChangedFunc: connectionConfigChanged,
+		TableMapFunc:                pluginTableDefinitions,
 	}
 	return p
 }
+
+// pluginTableDefinitions validates the connection config as the connection
+// loads, so bad settings are reported up front rather than on first query.
+func pluginTableDefinitions(ctx context.Context, td *plugin.TableMapData) (map[string]*plugin.Table, error) {
+	if err := GetConfig(td.Connection).validate(); err != nil {
+		plugin.Logger(ctx).Error("crtsh.pluginTableDefinitions", "config_error", err)
+		return nil, err
+	}
+	return map[string]*plugin.Table{
+		"crtsh_ca":          tableCrtshCa(),
+		"crtsh_ca_issuer":   tableCrtshCaIssuer(),
+		"crtsh_certificate": tableCrtshCertificate(),
+		"crtsh_log":         tableCrtshLog(),
+		"crtsh_log_entry":   tableCrtshLogEntry(),
+	}, nil
+}
@@ -0,0 +1,311 @@
+package crtsh
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/quals"
+)
+
+// sqlColumn maps a key column of a table to the SQL expression used to filter
+// on it.
+type sqlColumn struct {
+	// Name of the Steampipe column
+	Name string
+	// Expr is the SQL expression for the column, defaulting to Name
+	Expr string
+	Type proto.ColumnType
+	// Decode is set for a STRING column of encoded bytes, e.g. a hex
+	// fingerprint, where Expr is bytea. Quals are decoded so the index on Expr
+	// can be used.
+	Decode func(string) []byte
+}
+
+func (c sqlColumn) expr() string {
+	if c.Expr != "" {
+		return c.Expr
+	}
+	return c.Name
+}
+
+// queryBuilder builds a parameterised select statement. Placeholders are
+// numbered in the order arguments are added, so the same calls always give
+// the same SQL.
+type queryBuilder struct {
+	ctes       []string
+	distinctOn string
+	selects    []string
+	from       string
+	where      []string
+	orderBy    []string
+	limit      string
+	args       []interface{}
+}
+
+func newQueryBuilder(from string, selects ...string) *queryBuilder {
+	return &queryBuilder{from: from, selects: selects}
+}
+
+// With adds a common table expression, e.g. With("ca_expanded", "select ...").
+func (qb *queryBuilder) With(name, query string) *queryBuilder {
+	qb.ctes = append(qb.ctes, fmt.Sprintf("%s as (\n%s\n)", name, strings.TrimSpace(query)))
+	return qb
+}
+
+// DistinctOn sets the select distinct on (...) expression.
+func (qb *queryBuilder) DistinctOn(expr string) *queryBuilder {
+	qb.distinctOn = expr
+	return qb
+}
+
+// Arg adds an argument, returning its placeholder.
+func (qb *queryBuilder) Arg(v interface{}) string {
+	qb.args = append(qb.args, v)
+	return fmt.Sprintf("$%d", len(qb.args))
+}
+
+// Where adds a condition, all conditions must be true.
+func (qb *queryBuilder) Where(condition string) *queryBuilder {
+	qb.where = append(qb.where, condition)
+	return qb
+}
+
+// WhereQuals adds a condition for each qual of the given columns. Quals are
+// taken in column order, so the placeholder numbering is deterministic.
+func (qb *queryBuilder) WhereQuals(req *listRequest, columns []sqlColumn) *queryBuilder {
+	for _, col := range columns {
+		if req.Quals[col.Name] == nil {
+			continue
+		}
+		for _, q := range req.Quals[col.Name].Quals {
+			if condition, ok := qb.qualCondition(col, q); ok {
+				qb.Where(condition)
+			}
+		}
+	}
+	return qb
+}
+
+func (qb *queryBuilder) qualCondition(col sqlColumn, q *quals.Qual) (string, bool) {
+	switch q.Operator {
+	case "is null", "is not null":
+		return fmt.Sprintf("%s %s", col.expr(), q.Operator), true
+	}
+	if list := q.Value.GetListValue(); list != nil {
+		return qb.listCondition(col, q.Operator, list)
+	}
+	switch q.Operator {
+	case "=", "<>", "<", "<=", ">", ">=":
+	// Pattern and regex matches, which crt.sh can serve from its trigram
+	// indexes. Postgres uses the same operator names as Steampipe.
+	case "~~", "~~*", "!~~", "!~~*", "~", "~*", "!~", "!~*":
+		if col.Type != proto.ColumnType_STRING {
+			return "", false
+		}
+	default:
+		return "", false
+	}
+	v, ok := qualArg(col, q.Value)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%s %s %s", col.expr(), q.Operator, qb.Arg(v)), true
+}
+
+// listCondition turns a list qual, e.g. "id in (1, 2, 3)", into a single
+// array parameter: "id = any($1)". Not in becomes "id <> all($1)".
+//
+// Note: when a list qual is the only one, Steampipe calls the list function
+// once per value instead, so this only applies when several list quals are
+// pushed down together, e.g. "certificate_id in (...) and ct_log_id in
+// (...)". Joins and "in (select ...)" also pass one value per call.
+func (qb *queryBuilder) listCondition(col sqlColumn, operator string, list *proto.QualValueList) (string, bool) {
+	var quantifier string
+	switch operator {
+	case "=":
+		quantifier = "any"
+	case "<>":
+		quantifier = "all"
+	default:
+		return "", false
+	}
+	v, ok := qualArrayArg(col, list)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%s %s %s(%s)", col.expr(), operator, quantifier, qb.Arg(v)), true
+}
+
+// qualArrayArg converts the values of a list qual to an array argument for a
+// column type.
+func qualArrayArg(col sqlColumn, list *proto.QualValueList) (interface{}, bool) {
+	if col.Decode != nil {
+		values := make([][]byte, len(list.Values))
+		for i, v := range list.Values {
+			values[i] = col.Decode(v.GetStringValue())
+		}
+		return pq.ByteaArray(values), true
+	}
+	switch col.Type {
+	case proto.ColumnType_STRING:
+		values := make([]string, len(list.Values))
+		for i, v := range list.Values {
+			values[i] = v.GetStringValue()
+		}
+		return pq.Array(values), true
+	case proto.ColumnType_TIMESTAMP:
+		// Sent as text, Postgres casts the elements to the column type.
+		values := make([]string, len(list.Values))
+		for i, v := range list.Values {
+			values[i] = v.GetTimestampValue().AsTime().Format(time.RFC3339Nano)
+		}
+		return pq.Array(values), true
+	case proto.ColumnType_INT:
+		values := make([]int64, len(list.Values))
+		for i, v := range list.Values {
+			values[i] = v.GetInt64Value()
+		}
+		return pq.Array(values), true
+	case proto.ColumnType_BOOL:
+		values := make([]bool, len(list.Values))
+		for i, v := range list.Values {
+			values[i] = v.GetBoolValue()
+		}
+		return pq.Array(values), true
+	default:
+		return nil, false
+	}
+}
+
+// qualArg converts a qual value to a query argument for a column type.
+func qualArg(col sqlColumn, v *proto.QualValue) (interface{}, bool) {
+	if col.Decode != nil {
+		return col.Decode(v.GetStringValue()), true
+	}
+	switch col.Type {
+	case proto.ColumnType_STRING:
+		return v.GetStringValue(), true
+	case proto.ColumnType_TIMESTAMP:
+		return v.GetTimestampValue().AsTime(), true
+	case proto.ColumnType_INT:
+		return v.GetInt64Value(), true
+	case proto.ColumnType_BOOL:
+		return v.GetBoolValue(), true
+	default:
+		return nil, false
+	}
+}
+
+// After adds a condition for the rows following a key, e.g.
+// "(ct_log_id, entry_id) > ($1, $2)". There is no condition for a nil key.
+func (qb *queryBuilder) After(columns []string, values []interface{}) *queryBuilder {
+	if values == nil {
+		return qb
+	}
+	placeholders := make([]string, len(values))
+	for i, v := range values {
+		placeholders[i] = qb.Arg(v)
+	}
+	if len(columns) == 1 {
+		return qb.Where(fmt.Sprintf("%s > %s", columns[0], placeholders[0]))
+	}
+	return qb.Where(fmt.Sprintf("(%s) > (%s)", strings.Join(columns, ", "), strings.Join(placeholders, ", ")))
+}
+
+// decodeHex decodes a hex qual value, in any of the formats accepted by
+// hexBytes. A value that is not hex cannot match any row, so it is passed as
+// empty bytes rather than dropping the condition.
+func decodeHex(s string) []byte {
+	b, ok := hexBytes(s)
+	if !ok {
+		return []byte{}
+	}
+	return b
+}
+
+// decodeSerialNumber decodes a serial number qual value, in plain or colon
+// separated hex, to the bytes returned by x509_serialNumber.
+func decodeSerialNumber(s string) []byte {
+	b, ok := serialNumberBytes(s)
+	if !ok {
+		return []byte{}
+	}
+	return b
+}
+
+// OrderBy adds an order by expression, e.g. "id desc".
+func (qb *queryBuilder) OrderBy(expr string) *queryBuilder {
+	qb.orderBy = append(qb.orderBy, expr)
+	return qb
+}
+
+// OrderBySort adds the sort order of the request. Nulls are placed explicitly
+// where Postgres puts them by default, which is what Steampipe expects of a
+// pushed down sort.
+func (qb *queryBuilder) OrderBySort(req *listRequest, columns []sqlColumn) *queryBuilder {
+	for _, o := range req.SortOrder {
+		expr := o.Column
+		for _, col := range columns {
+			if col.Name == o.Column {
+				expr = col.expr()
+			}
+		}
+		switch o.Order {
+		case plugin.SortAsc:
+			qb.OrderBy(expr + " asc nulls last")
+		case plugin.SortDesc:
+			qb.OrderBy(expr + " desc nulls first")
+		}
+	}
+	return qb
+}
+
+// Subquery returns a builder selecting from the query built so far, e.g. to
+// order the rows of a select distinct on (...) by another column. Arguments
+// are carried over, so placeholders keep their numbering.
+func (qb *queryBuilder) Subquery(alias string) *queryBuilder {
+	q, args := qb.Build()
+	return &queryBuilder{
+		from:    fmt.Sprintf("(\n%s\n) as %s", q, alias),
+		selects: []string{"*"},
+		args:    args,
+	}
+}
+
+// Limit sets the limit, if there is one.
+func (qb *queryBuilder) Limit(limit *int64) *queryBuilder {
+	if limit != nil {
+		qb.limit = qb.Arg(*limit)
+	}
+	return qb
+}
+
+// Build returns the SQL and its arguments.
+func (qb *queryBuilder) Build() (string, []interface{}) {
+	var sb strings.Builder
+	if len(qb.ctes) > 0 {
+		sb.WriteString("with ")
+		sb.WriteString(strings.Join(qb.ctes, ", "))
+		sb.WriteString("\n")
+	}
+	sb.WriteString("select ")
+	if qb.distinctOn != "" {
+		sb.WriteString("distinct on (" + qb.distinctOn + ") ")
+	}
+	sb.WriteString(strings.Join(qb.selects, ", "))
+	sb.WriteString("\nfrom " + qb.from)
+	if len(qb.where) > 0 {
+		sb.WriteString("\nwhere " + strings.Join(qb.where, " and "))
+	}
+	if len(qb.orderBy) > 0 {
+		sb.WriteString("\norder by " + strings.Join(qb.orderBy, ", "))
+	}
+	if qb.limit != "" {
+		sb.WriteString("\nlimit " + qb.limit)
+	}
+	return sb.String(), qb.args
+}
@@ -0,0 +1,244 @@
+package crtsh
+
+import (
+	"database/sql/driver"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// goldenQuery renders a query and its arguments as stored in the golden
+// files.
+func goldenQuery(qb *queryBuilder) string {
+	q, args := qb.Build()
+	var sb strings.Builder
+	sb.WriteString(q)
+	sb.WriteString("\n")
+	for i, arg := range args {
+		fmt.Fprintf(&sb, "-- $%d = %s\n", i+1, goldenArg(arg))
+	}
+	return sb.String()
+}
+
+func goldenArg(arg interface{}) string {
+	switch v := arg.(type) {
+	case []byte:
+		return fmt.Sprintf(`'\x%x'::bytea`, v)
+	case string:
+		return fmt.Sprintf("'%s'", v)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case driver.Valuer:
+		value, err := v.Value()
+		if err != nil {
+			return "error: " + err.Error()
+		}
+		return fmt.Sprintf("'%s' (%T)", value, v)
+	default:
+		return fmt.Sprintf("%v (%T)", v, v)
+	}
+}
+
+func withSort(req *listRequest, sort ...*plugin.SortColumn) *listRequest {
+	req.SortOrder = sort
+	return req
+}
+
+func withLimit(req *listRequest, limit int64) *listRequest {
+	req.Limit = &limit
+	return req
+}
+
+var (
+	testTime  = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	testTime2 = time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// TestQueryBuilderGolden compares the SQL generated for each combination of
+// quals with testdata/query_builder/<name>.sql. Postgres checks every qual
+// again on the rows returned, so the integration tests pass whether or not a
+// qual was pushed down. These tests pin down what is actually sent to crt.sh.
+//
+// Run with -update to rewrite the golden files after an intended change.
+func TestQueryBuilderGolden(t *testing.T) {
+	tests := []struct {
+		name  string
+		query func() (*queryBuilder, error)
+	}{
+		{"ca_no_quals", func() (*queryBuilder, error) {
+			return caQuery(testRequest(tableCrtshCa())), nil
+		}},
+		{"ca_scalar", func() (*queryBuilder, error) {
+			return caQuery(testRequest(tableCrtshCa(),
+				testQual("id", ">=", 5),
+				testQual("id", "<", 10),
+				testQual("name", "=", "C=US, O=Let's Encrypt, CN=R3"),
+				testQual("linting_applies", "<>", false),
+			)), nil
+		}},
+		{"ca_list", func() (*queryBuilder, error) {
+			return caQuery(testRequest(tableCrtshCa(),
+				testQual("id", "=", []interface{}{1, 2, 3}),
+				testQual("name", "<>", []interface{}{"a", "b"}),
+			)), nil
+		}},
+		{"ca_unsupported_operator", func() (*queryBuilder, error) {
+			// Pattern operators only apply to string columns
+			return caQuery(testRequest(tableCrtshCa(), testQual("id", "~~", "1%"))), nil
+		}},
+		{"ca_issuer_like_regex", func() (*queryBuilder, error) {
+			return caIssuerQuery(testRequest(tableCrtshCaIssuer(),
+				testQual("url", "~~*", "%.crt"),
+				testQual("url", "!~~", "http://%"),
+				testQual("result", "~", "^HTTP [45]"),
+				testQual("content_type", "!~*", "pem"),
+			)), nil
+		}},
+		{"ca_issuer_is_null", func() (*queryBuilder, error) {
+			return caIssuerQuery(testRequest(tableCrtshCaIssuer(),
+				testQual("next_check_due", "is null", nil),
+				testQual("result", "is not null", nil),
+				testQual("last_checked", ">", testTime),
+			)), nil
+		}},
+		{"ca_issuer_sort_limit", func() (*queryBuilder, error) {
+			return caIssuerQuery(withLimit(withSort(testRequest(tableCrtshCaIssuer(), testQual("ca_id", "=", 1)),
+				&plugin.SortColumn{Column: "last_checked", Order: plugin.SortDesc},
+				&plugin.SortColumn{Column: "url", Order: plugin.SortAsc},
+			), 10)), nil
+		}},
+		{"log_quals", func() (*queryBuilder, error) {
+			return logQuery(testRequest(tableCrtshLog(),
+				testQual("operator", "~~*", "%google%"),
+				testQual("is_active", "=", true),
+				testQual("tree_size", ">", 1000000),
+				testQual("chrome_inclusion_status", "=", []interface{}{"Usable", "Qualified"}),
+				testQual("chrome_disqualified_at", "is null", nil),
+			)), nil
+		}},
+		{"log_entry_first_page", func() (*queryBuilder, error) {
+			req := testRequest(tableCrtshLogEntry(), testQual("entry_timestamp", ">=", testTime), testQual("entry_timestamp", "<", testTime2))
+			return logEntryKeyset.page(logEntryQuery(req), nil, 10000), nil
+		}},
+		{"log_entry_after", func() (*queryBuilder, error) {
+			req := testRequest(tableCrtshLogEntry(), testQual("certificate_id", "=", []interface{}{101, 102}))
+			return logEntryKeyset.page(logEntryQuery(req), logEntryKeyset.values(logEntryRow{CtLogID: 2, EntryID: 500}), 100), nil
+		}},
+		{"ca_after", func() (*queryBuilder, error) {
+			return caKeyset.page(caQuery(testRequest(tableCrtshCa())), caKeyset.values(caRow{ID: 42}), 10000), nil
+		}},
+		{"certificate_query", func() (*queryBuilder, error) {
+			return certificateQuery(testRequest(tableCrtshCertificate(), testQual("query", "=", "example.com")))
+		}},
+		{"certificate_match_exact", func() (*queryBuilder, error) {
+			return certificateQuery(withLimit(testRequest(tableCrtshCertificate(),
+				testQual("query", "=", "example.com"),
+				testQual("match", "=", "exact"),
+				testQual("name_type", "=", "dNSName"),
+			), 5))
+		}},
+		{"certificate_match_suffix", func() (*queryBuilder, error) {
+			return certificateQuery(testRequest(tableCrtshCertificate(), testQual("query", "=", "example.com"), testQual("match", "=", "suffix")))
+		}},
+		{"certificate_match_substring", func() (*queryBuilder, error) {
+			return certificateQuery(testRequest(tableCrtshCertificate(), testQual("query", "=", "example"), testQual("match", "=", "substring")))
+		}},
+		{"certificate_validity", func() (*queryBuilder, error) {
+			return certificateQuery(testRequest(tableCrtshCertificate(),
+				testQual("query", "=", "example.com"),
+				testQual("not_after", ">", testTime),
+				testQual("not_before", "<=", testTime2),
+				testQual("issuer_ca_id", "<>", 16418),
+				testQual("exclude_expired", "=", true),
+			))
+		}},
+		{"certificate_sort_subquery_limit", func() (*queryBuilder, error) {
+			return certificateQuery(withLimit(withSort(testRequest(tableCrtshCertificate(), testQual("query", "=", "example.com")),
+				&plugin.SortColumn{Column: "not_after", Order: plugin.SortDesc},
+			), 10))
+		}},
+		{"certificate_fingerprints", func() (*queryBuilder, error) {
+			return certificateQuery(testRequest(tableCrtshCertificate(),
+				testQual("fingerprint_sha256", "=", "0b4eb1c17d6a7d8b7a3e2e3f0c0e8e4f5f35e7d0c8e2b5d0a8d7c6b5a4f3e2d1"),
+				testQual("fingerprint_sha1", "=", []interface{}{"00112233445566778899aabbccddeeff00112233", "not hex"}),
+			))
+		}},
+		{"certificate_fingerprint_formats", func() (*queryBuilder, error) {
+			return certificateQuery(testRequest(tableCrtshCertificate(),
+				testQual("fingerprint_sha1", "=", "00:11:22:33:44:55:66:77:88:99:AA:BB:CC:DD:EE:FF:00:11:22:33"),
+				testQual("spki_sha256", "=", "9B 89 75 1C 9C 91 54 B7 0F 9F CE 21 F4 55 BD C5 AE 82 97 DB 9B 89 75 1C 9C 91 54 B7 0F 9F CE 21"),
+			))
+		}},
+		{"certificate_serial_number", func() (*queryBuilder, error) {
+			return certificateQuery(testRequest(tableCrtshCertificate(), testQual("serial_number", "=", "8f:00:11:22:33:44:55:66")))
+		}},
+		{"certificate_spki", func() (*queryBuilder, error) {
+			return certificateQuery(testRequest(tableCrtshCertificate(), testQual("spki_sha256", "=", "9b89751c9c9154b70f9fce21f455bdc5ae8297db9b89751c9c9154b70f9fce21")))
+		}},
+		{"certificate_issuer_window", func() (*queryBuilder, error) {
+			return certificateQuery(testRequest(tableCrtshCertificate(),
+				testQual("issuer_ca_id", "=", []interface{}{16418, 183267}),
+				testQual("not_before", ">", testTime),
+			))
+		}},
+		{"certificate_domain", func() (*queryBuilder, error) {
+			return certificateQuery(testRequest(tableCrtshCertificate(), testQual("domain", "=", "WWW.Example.com")))
+		}},
+		{"certificate_domain_subdomains", func() (*queryBuilder, error) {
+			return certificateQuery(testRequest(tableCrtshCertificate(), testQual("domain", "=", "%.my_site.example.com")))
+		}},
+		{"certificate_organization_email", func() (*queryBuilder, error) {
+			return certificateQuery(testRequest(tableCrtshCertificate(),
+				testQual("organization", "=", "Example Corp Ltd"),
+				testQual("email", "=", "admin@example.com"),
+			))
+		}},
+		{"distinct_on_subquery", func() (*queryBuilder, error) {
+			qb := newQueryBuilder("t", "a", "b").DistinctOn("a")
+			qb.Where(fmt.Sprintf("b = %s", qb.Arg("x")))
+			qb = qb.Subquery("s")
+			qb.Where(fmt.Sprintf("a > %s", qb.Arg(int64(1))))
+			return qb.OrderBy("b desc").Limit(testLimit(3)), nil
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qb, err := tt.query()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := goldenQuery(qb)
+
+			path := filepath.Join("testdata", "query_builder", tt.name+".sql")
+			if *update {
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("missing golden file, run go test -update: %v", err)
+			}
+			if got != string(want) {
+				t.Errorf("query does not match %s\ngot:\n%s\nwant:\n%s", path, got, want)
+			}
+
+			// The same calls must always give the same SQL
+			if again, _ := tt.query(); goldenQuery(again) != got {
+				t.Error("query is not deterministic")
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package crtsh
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	defaultMaxErrorRetryAttempts = 3
+	defaultMinErrorRetryDelay    = 100
+	defaultMaxErrorRetryDelay    = 5000
+)
+
+// retryConfig controls retries of read-only queries that fail with a
+// transient error. Delays are in milliseconds.
+type retryConfig struct {
+	maxAttempts int
+	minDelay    time.Duration
+	maxDelay    time.Duration
+}
+
+func newRetryConfig(config crtshConfig) retryConfig {
+	r := retryConfig{
+		maxAttempts: defaultMaxErrorRetryAttempts,
+		minDelay:    defaultMinErrorRetryDelay * time.Millisecond,
+		maxDelay:    defaultMaxErrorRetryDelay * time.Millisecond,
+	}
+	if config.MaxErrorRetryAttempts != nil {
+		r.maxAttempts = *config.MaxErrorRetryAttempts
+	}
+	if config.MinErrorRetryDelay != nil {
+		r.minDelay = time.Duration(*config.MinErrorRetryDelay) * time.Millisecond
+	}
+	if config.MaxErrorRetryDelay != nil {
+		r.maxDelay = time.Duration(*config.MaxErrorRetryDelay) * time.Millisecond
+	}
+	return r
+}
+
+// backoff returns the delay before the given retry attempt (starting at 0),
+// doubling each time up to maxDelay, with jitter so concurrent queries do not
+// retry in lock step.
+func (r retryConfig) backoff(attempt int) time.Duration {
+	delay := r.minDelay
+	for i := 0; i < attempt && delay < r.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > r.maxDelay {
+		delay = r.maxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	// Equal jitter: half fixed, half random.
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// wait sleeps for the backoff delay of the attempt, returning early with the
+// context error if the query is cancelled.
+func (r retryConfig) wait(ctx context.Context, attempt int) error {
+	timer := time.NewTimer(r.backoff(attempt))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// isRetryableError returns true if the error is a transient failure of a
+// read-only query, where running the query again may succeed. The crt.sh guest
+// database is served by hot standby replicas, which regularly cancel queries
+// and refuse or drop connections under load.
+func isRetryableError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Class() {
+		// connection_exception
+		case "08":
+			return true
+		// transaction_rollback, including serialization_failure (40001) which
+		// is raised for "canceling statement due to conflict with recovery"
+		case "40":
+			return true
+		}
+		switch pqErr.Code {
+		// too_many_connections
+		case "53300":
+			return true
+		// admin_shutdown, crash_shutdown and cannot_connect_now
+		case "57P01", "57P02", "57P03":
+			return true
+		}
+		return false
+	}
+
+	// Dropped connections surface from the driver rather than the server.
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,113 @@
+package crtsh
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestIsRetryableError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"connection_exception", &pq.Error{Code: "08006"}, true},
+		{"connection_does_not_exist", &pq.Error{Code: "08003"}, true},
+		{"serialization_failure", &pq.Error{Code: "40001", Message: "canceling statement due to conflict with recovery"}, true},
+		{"deadlock_detected", &pq.Error{Code: "40P01"}, true},
+		{"too_many_connections", &pq.Error{Code: "53300"}, true},
+		{"out_of_memory", &pq.Error{Code: "53200"}, false},
+		{"admin_shutdown", &pq.Error{Code: "57P01"}, true},
+		{"crash_shutdown", &pq.Error{Code: "57P02"}, true},
+		{"cannot_connect_now", &pq.Error{Code: "57P03"}, true},
+		{"query_canceled", &pq.Error{Code: "57014", Message: "canceling statement due to statement timeout"}, false},
+		{"syntax_error", &pq.Error{Code: "42601"}, false},
+		{"wrapped", fmt.Errorf("crtsh_ca: %w", &pq.Error{Code: "40001"}), true},
+		{"bad connection", driver.ErrBadConn, true},
+		{"eof", io.EOF, true},
+		{"unexpected eof", fmt.Errorf("result set ended early: %w", io.ErrUnexpectedEOF), true},
+		{"network", &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}, true},
+		{"canceled", context.Canceled, false},
+		{"deadline", context.DeadlineExceeded, false},
+		{"other", errors.New("invalid input"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryableError(tt.err); got != tt.want {
+				t.Errorf("isRetryableError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	r := retryConfig{maxAttempts: 5, minDelay: 100 * time.Millisecond, maxDelay: 1000 * time.Millisecond}
+
+	tests := []struct {
+		attempt int
+		// delay before jitter, the backoff is between half and all of it
+		want time.Duration
+	}{
+		{0, 100 * time.Millisecond},
+		{1, 200 * time.Millisecond},
+		{2, 400 * time.Millisecond},
+		{3, 800 * time.Millisecond},
+		{4, 1000 * time.Millisecond},
+		{10, 1000 * time.Millisecond},
+		{100, 1000 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("attempt %d", tt.attempt), func(t *testing.T) {
+			varied := false
+			first := r.backoff(tt.attempt)
+			for i := 0; i < 100; i++ {
+				got := r.backoff(tt.attempt)
+				if got < tt.want/2 || got > tt.want {
+					t.Fatalf("backoff(%d) = %s, want between %s and %s", tt.attempt, got, tt.want/2, tt.want)
+				}
+				varied = varied || got != first
+			}
+			if !varied {
+				t.Errorf("backoff(%d) returned %s every time, want jitter", tt.attempt, first)
+			}
+		})
+	}
+}
+
+func TestBackoffZeroDelay(t *testing.T) {
+	r := retryConfig{maxAttempts: 1}
+	if got := r.backoff(0); got != 0 {
+		t.Errorf("backoff(0) = %s, want 0", got)
+	}
+}
+
+func TestRetryWaitCancelled(t *testing.T) {
+	r := retryConfig{maxAttempts: 1, minDelay: time.Hour, maxDelay: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := r.wait(ctx, 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("wait returned %v, want context.Canceled", err)
+	}
+}
+
+func TestNewRetryConfig(t *testing.T) {
+	r := newRetryConfig(crtshConfig{})
+	if r.maxAttempts != defaultMaxErrorRetryAttempts || r.minDelay != 100*time.Millisecond || r.maxDelay != 5*time.Second {
+		t.Errorf("got default retry config %+v", r)
+	}
+
+	attempts, minDelay, maxDelay := 0, 10, 20
+	r = newRetryConfig(crtshConfig{MaxErrorRetryAttempts: &attempts, MinErrorRetryDelay: &minDelay, MaxErrorRetryDelay: &maxDelay})
+	if r.maxAttempts != 0 || r.minDelay != 10*time.Millisecond || r.maxDelay != 20*time.Millisecond {
+		t.Errorf("got retry config %+v", r)
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"time"
 
 	"github.com/jmoiron/sqlx/types"
-	_ "github.com/lib/pq"
 
 	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
@@ -19,18 +18,18 @@ func tableCrtshCaIssuer() *plugin.Table {
 			Hydrate: listCaIssuer,
 			KeyColumns: []*plugin.KeyColumn{
 				{Name: "ca_id", Operators: []string{">", ">=", "=", "<", "<=", "<>"}, Require: plugin.Optional},
-				{Name: "next_check_due", Operators: []string{">", ">=", "=", "<", "<=", "<>"}, Require: plugin.Optional},
-				{Name: "last_checked", Operators: []string{">", ">=", "=", "<", "<=", "<>"}, Require: plugin.Optional},
-				{Name: "url", Operators: []string{">", ">=", "=", "<", "<=", "<>"}, Require: plugin.Optional},
-				{Name: "result", Operators: []string{">", ">=", "=", "<", "<=", "<>"}, Require: plugin.Optional},
-				{Name: "first_certificate_id", Operators: []string{">", ">=", "=", "<", "<=", "<>"}, Require: plugin.Optional},
-				{Name: "is_active", Operators: []string{"=", "<>"}, Require: plugin.Optional},
-				{Name: "content_type", Operators: []string{">", ">=", "=", "<", "<=", "<>"}, Require: plugin.Optional},
+				{Name: "next_check_due", Operators: []string{">", ">=", "=", "<", "<=", "<>", "is null", "is not null"}, Require: plugin.Optional},
+				{Name: "last_checked", Operators: []string{">", ">=", "=", "<", "<=", "<>", "is null", "is not null"}, Require: plugin.Optional},
+				{Name: "url", Operators: []string{">", ">=", "=", "<", "<=", "<>", "~~", "~~*", "!~~", "!~~*", "~", "~*", "!~", "!~*"}, Require: plugin.Optional},
+				{Name: "result", Operators: []string{">", ">=", "=", "<", "<=", "<>", "~~", "~~*", "!~~", "!~~*", "~", "~*", "!~", "!~*", "is null", "is not null"}, Require: plugin.Optional},
+				{Name: "first_certificate_id", Operators: []string{">", ">=", "=", "<", "<=", "<>", "is null", "is not null"}, Require: plugin.Optional},
+				{Name: "is_active", Operators: []string{"=", "<>", "is null", "is not null"}, Require: plugin.Optional},
+				{Name: "content_type", Operators: []string{">", ">=", "=", "<", "<=", "<>", "~~", "~~*", "!~~", "!~~*", "~", "~*", "!~", "!~*", "is null", "is not null"}, Require: plugin.Optional},
 			},
 		},
 		Columns: []*plugin.Column{
 			// Top columns
-			{Name: "ca_id", Type: proto.ColumnType_INT, Description: "Unique ID of the CA represented by this issuer record."},
+			{Name: "ca_id", Type: proto.ColumnType_INT, Sort: plugin.SortAll, Description: "Unique ID of the CA represented by this issuer record."},
 			{Name: "url", Type: proto.ColumnType_STRING, Description: "URL of the CA represented by this issuer record."},
 			{Name: "result", Type: proto.ColumnType_STRING, Description: "Status of last check of the CA issuer."},
 			{Name: "ca_certificate_ids", Type: proto.ColumnType_JSON, Description: "Certificate IDs used by the CA issuer."},
@@ -38,8 +37,8 @@ func tableCrtshCaIssuer() *plugin.Table {
 			{Name: "is_active", Type: proto.ColumnType_BOOL, Description: "True if the CA is active."},
 			{Name: "content_type", Type: proto.ColumnType_STRING, Description: "Content type of the issuer certificate."},
 			// Other columns
-			{Name: "last_checked", Type: proto.ColumnType_TIMESTAMP, Description: "Time when the certificate was last checked."},
-			{Name: "next_check_due", Type: proto.ColumnType_TIMESTAMP, Description: "Time when the certificate will be checked next."},
+			{Name: "last_checked", Type: proto.ColumnType_TIMESTAMP, Sort: plugin.SortAll, Description: "Time when the certificate was last checked."},
+			{Name: "next_check_due", Type: proto.ColumnType_TIMESTAMP, Sort: plugin.SortAll, Description: "Time when the certificate will be checked next."},
 		},
 	}
 }
@@ -58,42 +57,20 @@ type caIssuerRow struct {
 
 func listCaIssuer(ctx context.Context, d *plugin.QueryData, _ *plugin.HydrateData) (interface{}, error) {
 
-	db, err := connect(ctx, d)
+	b, err := getBackend(ctx, d)
 	if err != nil {
 		plugin.Logger(ctx).Error("crtsh_ca_issuer.listCaIssuer", "connection_error", err)
 		return nil, err
 	}
 
-	q := `
-		select
-			ca_id,
-			url,
-			result,
-			to_jsonb(ca_certificate_ids) as ca_certificate_ids,
-			first_certificate_id,
-			is_active,
-			content_type,
-			next_check_due,
-			last_checked
-		from ca_issuer
-	`
-
-	q, args := queryWithQuals(ctx, d, q)
-
-	i := caIssuerRow{}
-	rows, err := db.QueryxContext(ctx, q, args...)
+	err = b.ListCaIssuer(ctx, newListRequest(d), func(i caIssuerRow) bool {
+		d.StreamListItem(ctx, i)
+		return d.RowsRemaining(ctx) != 0
+	})
 	if err != nil {
 		plugin.Logger(ctx).Error("crtsh_ca_issuer.listCaIssuer", "query_error", err)
 		return nil, err
 	}
-	for rows.Next() {
-		err := rows.StructScan(&i)
-		if err != nil {
-			plugin.Logger(ctx).Error("crtsh_ca_issuer.listCaIssuer", "row_error", err)
-			continue
-		}
-		d.StreamListItem(ctx, i)
-	}
 
-	return nil, err
+	return nil, nil
 }
@@ -2,9 +2,10 @@ package crtsh
 
 import (
 	"context"
+	"crypto/sha1"
+	"crypto/sha256"
 	"crypto/x509"
 	"fmt"
-	"regexp"
 	"strings"
 	"time"
 
@@ -22,109 +23,283 @@ func tableCrtshCertificate() *plugin.Table {
 			KeyColumns: []*plugin.KeyColumn{
 				{Name: "id", Require: plugin.AnyOf},
 				{Name: "query", Require: plugin.AnyOf, CacheMatch: "exact"},
+				{Name: "domain", Require: plugin.AnyOf},
+				{Name: "organization", Require: plugin.AnyOf},
+				{Name: "email", Require: plugin.AnyOf},
+				{Name: "fingerprint_sha1", Require: plugin.AnyOf},
+				{Name: "fingerprint_sha256", Require: plugin.AnyOf},
+				{Name: "serial_number", Require: plugin.AnyOf},
+				{Name: "spki_sha256", Require: plugin.AnyOf},
+				{Name: "issuer_ca_id", Operators: []string{">", ">=", "=", "<", "<=", "<>"}, Require: plugin.AnyOf},
 				{Name: "not_after", Operators: []string{">", ">=", "=", "<", "<=", "<>"}, Require: plugin.Optional},
+				{Name: "not_before", Operators: []string{">", ">=", "=", "<", "<=", "<>"}, Require: plugin.Optional},
+				{Name: "exclude_expired", Require: plugin.Optional},
+				{Name: "name_type", Require: plugin.Optional},
+				{Name: "match", Require: plugin.Optional},
 			},
 		},
+		HydrateConfig: []plugin.HydrateConfig{
+			{Func: getCertificateDER, MaxConcurrency: maxCertificateDownloads},
+			{Func: parseCertificate, Depends: []plugin.HydrateFunc{getCertificateDER}},
+		},
 		Columns: []*plugin.Column{
 			// Top columns
 			{Name: "id", Type: proto.ColumnType_INT, Transform: transform.FromField("CertificateID"), Description: "Unique ID of the certificate in crt.sh."},
 			{Name: "dns_names", Type: proto.ColumnType_JSON, Hydrate: parseCertificate, Description: "DNS names represented by the certificate, e.g. steampipe.io"},
 			{Name: "not_before", Type: proto.ColumnType_TIMESTAMP, Hydrate: parseCertificate, Description: "The certificate invalid before this time."},
-			{Name: "not_after", Type: proto.ColumnType_TIMESTAMP, Description: "The certificate is invalid after this time."},
+			{Name: "not_after", Type: proto.ColumnType_TIMESTAMP, Sort: plugin.SortAll, Description: "The certificate is invalid after this time."},
 			{Name: "subject", Type: proto.ColumnType_JSON, Hydrate: parseCertificate, Description: "Details about the Subject of the certificate, e.g. CommonName, OrganizationalUnit, etc."},
 			// Other columns
+			{Name: "domain", Type: proto.ColumnType_STRING, Transform: transform.FromQual("domain"), Description: "Domain name to search for, e.g. example.com for that name only or %.example.com for all of its subdomains."},
+			{Name: "email", Type: proto.ColumnType_STRING, Transform: transform.FromQual("email"), Description: "Email address to search for in the subject of S/MIME certificates, e.g. admin@example.com."},
 			{Name: "email_addresses", Type: proto.ColumnType_JSON, Hydrate: parseCertificate, Description: "Email addresses associated with the certificate."},
-			{Name: "fingerprint_sha1", Type: proto.ColumnType_STRING, Transform: transform.FromField("Certificate").Transform(sha1Fingerprint), Description: "SHA1 fingerprint of the certificate, e.g. abcd12..."},
-			{Name: "fingerprint_sha256", Type: proto.ColumnType_STRING, Transform: transform.FromField("Certificate").Transform(sha256Fingerprint), Description: "SHA256 fingerprint of the certificate, e.g. abcd12..."},
+			{Name: "exclude_expired", Type: proto.ColumnType_BOOL, Transform: transform.FromQual("exclude_expired"), Description: "If true, only certificates that have not expired are returned, like exclude=expired in the crt.sh search."},
+			{Name: "fingerprint_sha1", Type: proto.ColumnType_STRING, Hydrate: getCertificateDER, Transform: transform.FromValue().Transform(sha1Fingerprint), Description: "SHA1 fingerprint of the certificate, e.g. abcd12... Searches also accept uppercase, colon or space separated hex."},
+			{Name: "fingerprint_sha256", Type: proto.ColumnType_STRING, Hydrate: getCertificateDER, Transform: transform.FromValue().Transform(sha256Fingerprint), Description: "SHA256 fingerprint of the certificate, e.g. abcd12... Searches also accept uppercase, colon or space separated hex."},
 			{Name: "ip_addresses", Type: proto.ColumnType_JSON, Hydrate: parseCertificate, Description: "IP addresses associated with the certificate."},
 			{Name: "is_ca", Type: proto.ColumnType_BOOL, Hydrate: parseCertificate, Transform: transform.FromField("IsCA"), Description: "True if this certificate is a Certificate Authority."},
 			{Name: "issuer", Type: proto.ColumnType_JSON, Hydrate: parseCertificate, Description: "Details about the Certificate Authority who issued the certificate, e.g. CommonName, "},
 			{Name: "issuer_ca_id", Type: proto.ColumnType_INT, Description: "ID of the Certificate Authority who issued the certificate."},
+			{Name: "match", Type: proto.ColumnType_STRING, Transform: transform.FromQual("match"), Description: "How the query is matched against the certificate identities: exact, suffix (the name and its subdomains), substring or full_text. Requires a query. By default full text matches are narrowed to identities containing the query."},
+			{Name: "name_type", Type: proto.ColumnType_STRING, Description: "Type of the identity that matched the search, e.g. dNSName, commonName, organizationName, rfc822Name or iPAddress."},
+			{Name: "organization", Type: proto.ColumnType_STRING, Transform: transform.FromQual("organization"), Description: "Subject organization to search for, e.g. Example Corp Ltd. Organizations are only included in OV and EV certificates."},
 			{Name: "public_key", Type: proto.ColumnType_STRING, Hydrate: parseCertificate, Transform: transform.FromField("PublicKey").Transform(publicKeyToPem), Description: "Public key of the certificate in PEM format."},
 			{Name: "public_key_algorithm", Type: proto.ColumnType_STRING, Hydrate: parseCertificate, Description: "Algorithm used for the public key. e.g. RSA."},
 			{Name: "query", Type: proto.ColumnType_STRING, Transform: transform.FromQual("query"), Description: "The query provided for the certificate search."},
 			{Name: "serial_number", Type: proto.ColumnType_STRING, Hydrate: parseCertificate, Transform: transform.FromField("SerialNumber").Transform(serialNumberToHex), Description: "Unique identifier assigned by the Certificate Authority who issued the certificate."},
 			{Name: "signature_algorithm", Type: proto.ColumnType_STRING, Hydrate: parseCertificate, Description: "Algorithm used for the signature, e.g. SHA256-RSA."},
+			{Name: "spki_sha256", Type: proto.ColumnType_STRING, Hydrate: parseCertificate, Transform: transform.FromField("RawSubjectPublicKeyInfo").Transform(spkiSha256), Description: "SHA256 hash of the Subject Public Key Info of the certificate, e.g. abcd12... Certificates with the same key pair have the same hash. Searches also accept uppercase, colon or space separated hex."},
 			{Name: "uris", Type: proto.ColumnType_JSON, Hydrate: parseCertificate, Description: "URIs associated with the certificate."},
 			{Name: "version", Type: proto.ColumnType_INT, Hydrate: parseCertificate, Description: "Version of the certificate, e.g. 3."},
 			// Large columns
-			{Name: "certificate", Type: proto.ColumnType_STRING, Transform: transform.FromField("Certificate").Transform(byteArrayToString), Description: "Full raw certificate string in hex format."},
+			{Name: "certificate", Type: proto.ColumnType_STRING, Hydrate: getCertificateDER, Transform: transform.FromValue().Transform(byteArrayToString), Description: "Full raw certificate string in hex format."},
 		},
 	}
 }
 
 type certificateRow struct {
 	CertificateID int        `db:"certificate_id"`
-	IssuerCaID    int        `db:"issuer_ca_id"`
+	IssuerCaID    *int       `db:"issuer_ca_id"`
 	NameType      string     `db:"name_type"`
 	NameValue     string     `db:"name_value"`
 	Certificate   []byte     `db:"certificate"`
 	NotAfter      *time.Time `db:"not_after"`
+	// NotBefore is only set by backends that do not return the certificate
+	// with the row, i.e. the crt.sh HTTP API. Otherwise it is parsed from
+	// the certificate when needed.
+	NotBefore *time.Time `db:"-"`
 }
 
-func parseCertificate(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
-	cr := h.Item.(certificateRow)
-	cert, err := x509.ParseCertificate(cr.Certificate)
-	if err != nil {
-		return x509.Certificate{}, nil
+// Values of the match qual of crtsh_certificate.
+const (
+	matchExact     = "exact"
+	matchSuffix    = "suffix"
+	matchSubstring = "substring"
+	matchFullText  = "full_text"
+)
+
+// certificateMatch returns the match qual of the request, or "" if there is
+// none.
+func certificateMatch(req *listRequest) (string, error) {
+	qual := equalsQual(req, "match")
+	if qual == nil {
+		return "", nil
+	}
+	if equalsQual(req, "query") == nil {
+		return "", fmt.Errorf("%s: match only applies to a query, e.g. query = 'example.com' and match = '%s'", req.Table, matchSuffix)
+	}
+	switch match := qual.Value.GetStringValue(); match {
+	case matchExact, matchSuffix, matchSubstring, matchFullText:
+		return match, nil
+	default:
+		return "", fmt.Errorf("%s: match must be one of %s, %s, %s or %s, got %q", req.Table, matchExact, matchSuffix, matchSubstring, matchFullText, match)
 	}
-	return cert, nil
 }
 
-func listCertificate(ctx context.Context, d *plugin.QueryData, _ *plugin.HydrateData) (interface{}, error) {
+// domainWildcard is the prefix of a domain qual matching all subdomains.
+const domainWildcard = "%."
+
+// matchesDomain reports whether an identity matches a domain qual, for
+// backends that cannot filter on the server.
+func matchesDomain(domain, name string) bool {
+	domain, name = strings.ToLower(domain), strings.ToLower(name)
+	if strings.HasPrefix(domain, domainWildcard) {
+		return strings.HasSuffix(name, domain[1:])
+	}
+	return name == domain
+}
+
+// matchesName reports whether an identity matches the query for a match
+// mode, for backends that cannot filter on the server. Full text matching is
+// left to crt.sh.
+func matchesName(match, query, name string) bool {
+	query, name = strings.ToLower(query), strings.ToLower(name)
+	switch match {
+	case matchExact:
+		return name == query
+	case matchSuffix:
+		return name == query || strings.HasSuffix(name, "."+query)
+	case matchSubstring:
+		return strings.Contains(name, query)
+	default:
+		return true
+	}
+}
 
-	db, err := connect(ctx, d)
+// excludedExpired reports whether the row is an expired certificate and
+// the request has exclude_expired set.
+func excludedExpired(req *listRequest, row certificateRow) bool {
+	qual := equalsQual(req, "exclude_expired")
+	if qual == nil || !qual.Value.GetBoolValue() {
+		return false
+	}
+	return row.NotAfter == nil || !row.NotAfter.After(time.Now())
+}
+
+// certificateValue returns the value of a key column of a certificate row,
+// for backends that cannot filter on the server. Columns computed from the
+// certificate are unknown if it has not been downloaded.
+func certificateValue(row certificateRow, col sqlColumn) (interface{}, bool) {
+	switch col.Name {
+	case "fingerprint_sha1", "fingerprint_sha256", "not_before", "serial_number", "spki_sha256":
+		if len(row.Certificate) == 0 {
+			if col.Name == "not_before" && row.NotBefore != nil {
+				return *row.NotBefore, true
+			}
+			return nil, false
+		}
+	default:
+		return rowValue(row, col)
+	}
+
+	switch col.Name {
+	case "fingerprint_sha1":
+		sum := sha1.Sum(row.Certificate)
+		return sum[:], true
+	case "fingerprint_sha256":
+		sum := sha256.Sum256(row.Certificate)
+		return sum[:], true
+	}
+	// As in crt.sh, the x509 functions return null for a certificate that
+	// cannot be parsed.
+	cert, err := x509.ParseCertificate(row.Certificate)
 	if err != nil {
-		plugin.Logger(ctx).Error("crtsh_certificate.listCertificate", "connection_error", err)
-		return nil, err
+		return nil, true
+	}
+	switch col.Name {
+	case "not_before":
+		return cert.NotBefore, true
+	case "serial_number":
+		return serialNumberDER(cert.SerialNumber), true
+	default:
+		sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		return sum[:], true
 	}
+}
 
-	q := `
-		select distinct on (certificate_id)
-			certificate_id,
-			issuer_ca_id,
-			name_type,
-			name_value,
-			certificate,
-			x509_notAfter(certificate) as not_after
-		from
-			certificate_and_identities
-	`
+// certificateSearchColumns are the key columns that narrow a certificate
+// search on their own. Without one of them, the search must be by issuer.
+var certificateSearchColumns = []string{"id", "query", "domain", "organization", "email", "fingerprint_sha1", "fingerprint_sha256", "serial_number", "spki_sha256"}
 
-	quals := d.EqualsQuals
-	whereClauses := []string{}
-	args := []interface{}{}
+// validateIssuerSearch checks a search by issuer_ca_id alone is for a single
+// CA and bounded by not_before, as a CA may have issued millions of
+// certificates.
+func validateIssuerSearch(req *listRequest) error {
+	for _, column := range certificateSearchColumns {
+		if req.Quals[column] != nil {
+			return nil
+		}
+	}
+	if equalsQual(req, "issuer_ca_id") == nil && !hasListQual(req, "issuer_ca_id") {
+		return fmt.Errorf("%s: a search by issuer_ca_id must be for specific CAs, e.g. issuer_ca_id = 16418", req.Table)
+	}
+	if req.Quals["not_before"] != nil {
+		for _, q := range req.Quals["not_before"].Quals {
+			switch q.Operator {
+			case ">", ">=", "=":
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%s: a search by issuer_ca_id must be bounded by not_before, e.g. not_before > now() - interval '1 day'", req.Table)
+}
+
+// hasListQual reports whether the column has an "=" qual with a list of
+// values, e.g. from "in (...)".
+func hasListQual(req *listRequest, column string) bool {
+	if req.Quals[column] == nil {
+		return false
+	}
+	for _, q := range req.Quals[column].Quals {
+		if q.Operator == "=" && q.Value.GetListValue() != nil {
+			return true
+		}
+	}
+	return false
+}
 
-	if quals["id"] != nil {
-		args = append(args, quals["id"].GetInt64Value())
-		whereClauses = append(whereClauses, fmt.Sprintf("certificate_id = $%d", len(args)))
+// maxCertificateDownloads limits the certificates downloaded at once from
+// the crt.sh web interface, which rate limits clients.
+const maxCertificateDownloads = 5
+
+// getCertificateDER returns the DER encoding of the certificate. The HTTP
+// backend does not include it in search results, so it is downloaded on
+// demand when a column needs it.
+func getCertificateDER(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	cr := h.Item.(certificateRow)
+	if len(cr.Certificate) > 0 {
+		return cr.Certificate, nil
 	}
 
-	if quals["query"] != nil {
-		args = append(args, quals["query"].GetStringValue())
-		whereClauses = append(whereClauses, fmt.Sprintf("plainto_tsquery('certwatch', $%d) @@ identities(certificate)", len(args)))
-		whereClauses = append(whereClauses, fmt.Sprintf("name_value ilike ('%%' || $%d || '%%')", len(args)))
+	b, err := getBackend(ctx, d)
+	if err != nil {
+		plugin.Logger(ctx).Error("crtsh_certificate.getCertificateDER", "connection_error", err)
+		return nil, err
+	}
+	// Fixtures and recordings include the certificate if it was available,
+	// so there is nothing to fetch for them.
+	fetcher, ok := b.(certificateFetcher)
+	if !ok {
+		return cr.Certificate, nil
+	}
+	der, err := fetcher.getCertificateDER(ctx, int64(cr.CertificateID))
+	if err != nil {
+		plugin.Logger(ctx).Error("crtsh_certificate.getCertificateDER", "api_error", err)
+		return nil, err
 	}
+	return der, nil
+}
 
-	q = q + " where " + strings.Join(whereClauses, " and ")
+func parseCertificate(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	der, _ := h.HydrateResults["getCertificateDER"].([]byte)
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return x509.Certificate{}, nil
+	}
+	return cert, nil
+}
 
-	plugin.Logger(ctx).Debug("crtsh_ca_issuer.listCertificate", "query", regexp.MustCompile(`(?m)[\s\n]+`).ReplaceAllString(q, " "))
-	plugin.Logger(ctx).Debug("crtsh_ca_issuer.listCertificate", "args", args)
+func listCertificate(ctx context.Context, d *plugin.QueryData, _ *plugin.HydrateData) (interface{}, error) {
 
-	i := certificateRow{}
-	rows, err := db.QueryxContext(ctx, q, args...)
+	b, err := getBackend(ctx, d)
 	if err != nil {
-		plugin.Logger(ctx).Error("crtsh_certificate.listCertificate", "query_error", err)
+		plugin.Logger(ctx).Error("crtsh_certificate.listCertificate", "connection_error", err)
 		return nil, err
 	}
-	for rows.Next() {
-		err := rows.StructScan(&i)
-		if err != nil {
-			plugin.Logger(ctx).Error("crtsh_certificate.listCertificate", "row_error", err)
-			continue
-		}
+
+	req := newListRequest(d)
+	if err := validateIssuerSearch(req); err != nil {
+		return nil, err
+	}
+
+	err = b.ListCertificate(ctx, req, func(i certificateRow) bool {
 		d.StreamListItem(ctx, i)
+		return d.RowsRemaining(ctx) != 0
+	})
+	if err != nil {
+		plugin.Logger(ctx).Error("crtsh_certificate.listCertificate", "query_error", err)
+		return nil, err
 	}
 
-	return nil, err
+	return nil, nil
 }
@@ -15,10 +15,29 @@ func tableCrtshLog() *plugin.Table {
 		Description: "Certificate transparency log operators.",
 		List: &plugin.ListConfig{
 			Hydrate: listLog,
+			KeyColumns: []*plugin.KeyColumn{
+				{Name: "id", Operators: []string{">", ">=", "=", "<", "<=", "<>"}, Require: plugin.Optional},
+				{Name: "operator", Operators: []string{">", ">=", "=", "<", "<=", "<>", "~~", "~~*", "!~~", "!~~*", "~", "~*", "!~", "!~*"}, Require: plugin.Optional},
+				{Name: "is_active", Operators: []string{"=", "<>"}, Require: plugin.Optional},
+				{Name: "latest_update", Operators: []string{"is null", "is not null"}, Require: plugin.Optional},
+				{Name: "latest_sth_timestamp", Operators: []string{">", ">=", "=", "<", "<=", "<>", "is null", "is not null"}, Require: plugin.Optional},
+				{Name: "mmd_in_seconds", Operators: []string{"is null", "is not null"}, Require: plugin.Optional},
+				{Name: "tree_size", Operators: []string{">", ">=", "=", "<", "<=", "<>", "is null", "is not null"}, Require: plugin.Optional},
+				{Name: "batch_size", Operators: []string{"is null", "is not null"}, Require: plugin.Optional},
+				{Name: "chunk_size", Operators: []string{"is null", "is not null"}, Require: plugin.Optional},
+				{Name: "google_uptime", Operators: []string{"is null", "is not null"}, Require: plugin.Optional},
+				{Name: "chrome_version_added", Operators: []string{"is null", "is not null"}, Require: plugin.Optional},
+				{Name: "chrome_inclusion_status", Operators: []string{">", ">=", "=", "<", "<=", "<>", "~~", "~~*", "!~~", "!~~*", "~", "~*", "!~", "!~*", "is null", "is not null"}, Require: plugin.Optional},
+				{Name: "chrome_issue_number", Operators: []string{"is null", "is not null"}, Require: plugin.Optional},
+				{Name: "chrome_final_tree_size", Operators: []string{"is null", "is not null"}, Require: plugin.Optional},
+				{Name: "chrome_disqualified_at", Operators: []string{"is null", "is not null"}, Require: plugin.Optional},
+				{Name: "apple_inclusion_status", Operators: []string{">", ">=", "=", "<", "<=", "<>", "~~", "~~*", "!~~", "!~~*", "~", "~*", "!~", "!~*", "is null", "is not null"}, Require: plugin.Optional},
+				{Name: "apple_last_status_change", Operators: []string{"is null", "is not null"}, Require: plugin.Optional},
+			},
 		},
 		Columns: []*plugin.Column{
 			// Top columns
-			{Name: "id", Type: proto.ColumnType_INT, Description: "ID of the log."},
+			{Name: "id", Type: proto.ColumnType_INT, Sort: plugin.SortAll, Description: "ID of the log."},
 			{Name: "operator", Type: proto.ColumnType_STRING, Description: "Operator of the log."},
 			{Name: "name", Type: proto.ColumnType_STRING, Description: "Name of the log."},
 			{Name: "url", Type: proto.ColumnType_STRING, Description: "URL of the log."},
@@ -34,11 +53,11 @@ func tableCrtshLog() *plugin.Table {
 			{Name: "chrome_version_added", Type: proto.ColumnType_INT, Description: "Version when the log was included in Google Chrome, if any."},
 			{Name: "chunk_size", Type: proto.ColumnType_INT, Description: "Chunk size of the log."},
 			{Name: "google_uptime", Type: proto.ColumnType_STRING, Description: "Uptime percentage of the log according to Google."},
-			{Name: "latest_update", Type: proto.ColumnType_TIMESTAMP, Description: "Latest time when the log was contacted by crt.sh."},
-			{Name: "latest_sth_timestamp", Type: proto.ColumnType_TIMESTAMP, Description: "Latest Signed Tree Head (STH) timestamp of the log."},
+			{Name: "latest_update", Type: proto.ColumnType_TIMESTAMP, Sort: plugin.SortAll, Description: "Latest time when the log was contacted by crt.sh."},
+			{Name: "latest_sth_timestamp", Type: proto.ColumnType_TIMESTAMP, Sort: plugin.SortAll, Description: "Latest Signed Tree Head (STH) timestamp of the log."},
 			{Name: "mmd_in_seconds", Type: proto.ColumnType_INT, Description: "Maximum Merge Delay of the log."},
 			{Name: "public_key", Type: proto.ColumnType_STRING, Transform: transform.FromField("PublicKey").Transform(byteArrayToString), Description: "Public key of the log."},
-			{Name: "tree_size", Type: proto.ColumnType_INT, Description: "Tree size is the total number of nodes in the merkle tree for the log."},
+			{Name: "tree_size", Type: proto.ColumnType_INT, Sort: plugin.SortAll, Description: "Tree size is the total number of nodes in the merkle tree for the log."},
 		},
 	}
 }
@@ -68,53 +87,20 @@ type logRow struct {
 
 func listLog(ctx context.Context, d *plugin.QueryData, _ *plugin.HydrateData) (interface{}, error) {
 
-	db, err := connect(ctx, d)
+	b, err := getBackend(ctx, d)
 	if err != nil {
 		plugin.Logger(ctx).Error("crtsh_log.listLog", "connection_error", err)
 		return nil, err
 	}
 
-	q := `
-	select
-		id,
-		operator,
-		url,
-		name,
-		public_key,
-		is_active,
-		latest_update,
-		latest_sth_timestamp,
-		mmd_in_seconds,
-		tree_size,
-		batch_size,
-		chunk_size,
-		google_uptime,
-		chrome_version_added,
-		chrome_inclusion_status,
-		chrome_issue_number,
-		chrome_final_tree_size,
-		chrome_disqualified_at,
-		apple_inclusion_status,
-		apple_last_status_change
-	from
-	  ct_log`
-
-	q, args := queryWithQuals(ctx, d, q)
-
-	i := logRow{}
-	rows, err := db.QueryxContext(ctx, q, args...)
+	err = b.ListLog(ctx, newListRequest(d), func(i logRow) bool {
+		d.StreamListItem(ctx, i)
+		return d.RowsRemaining(ctx) != 0
+	})
 	if err != nil {
 		plugin.Logger(ctx).Error("crtsh_log.listLog", "query_error", err)
 		return nil, err
 	}
-	for rows.Next() {
-		err := rows.StructScan(&i)
-		if err != nil {
-			plugin.Logger(ctx).Error("crtsh_log.listLog", "row_error", err)
-			continue
-		}
-		d.StreamListItem(ctx, i)
-	}
 
-	return nil, err
+	return nil, nil
 }
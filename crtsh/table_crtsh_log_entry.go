@@ -17,16 +17,16 @@ func tableCrtshLogEntry() *plugin.Table {
 			KeyColumns: []*plugin.KeyColumn{
 				{Name: "certificate_id", Operators: []string{">", ">=", "=", "<", "<=", "<>"}, Require: plugin.AnyOf},
 				{Name: "entry_id", Operators: []string{">", ">=", "=", "<", "<=", "<>"}, Require: plugin.AnyOf},
-				{Name: "entry_timestamp", Operators: []string{">", ">=", "=", "<", "<=", "<>"}, Require: plugin.Optional},
+				{Name: "entry_timestamp", Operators: []string{">", ">=", "=", "<", "<=", "<>", "is null", "is not null"}, Require: plugin.Optional},
 				{Name: "ct_log_id", Operators: []string{">", ">=", "=", "<", "<=", "<>"}, Require: plugin.Optional},
 			},
 		},
 		Columns: []*plugin.Column{
 			// Top columns
 			{Name: "ct_log_id", Type: proto.ColumnType_INT, Description: "The log this entry is defined in."},
-			{Name: "entry_id", Type: proto.ColumnType_INT, Description: "Unique ID of the entry."},
-			{Name: "entry_timestamp", Type: proto.ColumnType_TIMESTAMP, Description: "Timestamp of the entry."},
-			{Name: "certificate_id", Type: proto.ColumnType_INT, Description: "Certificate the entry represents."},
+			{Name: "entry_id", Type: proto.ColumnType_INT, Sort: plugin.SortAll, Description: "Unique ID of the entry."},
+			{Name: "entry_timestamp", Type: proto.ColumnType_TIMESTAMP, Sort: plugin.SortAll, Description: "Timestamp of the entry."},
+			{Name: "certificate_id", Type: proto.ColumnType_INT, Sort: plugin.SortAll, Description: "Certificate the entry represents."},
 		},
 	}
 }
@@ -40,38 +40,20 @@ type logEntryRow struct {
 
 func listLogEntry(ctx context.Context, d *plugin.QueryData, _ *plugin.HydrateData) (interface{}, error) {
 
-	db, err := connect(ctx, d)
+	b, err := getBackend(ctx, d)
 	if err != nil {
-		plugin.Logger(ctx).Error("crtsh_log.listLogEntry", "connection_error", err)
+		plugin.Logger(ctx).Error("crtsh_log_entry.listLogEntry", "connection_error", err)
 		return nil, err
 	}
 
-	q := `
-		select
-			certificate_id,
-			entry_id,
-			entry_timestamp,
-			ct_log_id
-		from
-			ct_log_entry
-	`
-
-	q, args := queryWithQuals(ctx, d, q)
-
-	i := logEntryRow{}
-	rows, err := db.QueryxContext(ctx, q, args...)
+	err = b.ListLogEntry(ctx, newListRequest(d), func(i logEntryRow) bool {
+		d.StreamListItem(ctx, i)
+		return d.RowsRemaining(ctx) != 0
+	})
 	if err != nil {
-		plugin.Logger(ctx).Error("crtsh_log.listLogEntry", "query_error", err)
+		plugin.Logger(ctx).Error("crtsh_log_entry.listLogEntry", "query_error", err)
 		return nil, err
 	}
-	for rows.Next() {
-		err := rows.StructScan(&i)
-		if err != nil {
-			plugin.Logger(ctx).Error("crtsh_log.listLogEntry", "row_error", err)
-			continue
-		}
-		d.StreamListItem(ctx, i)
-	}
 
-	return nil, err
+	return nil, nil
 }
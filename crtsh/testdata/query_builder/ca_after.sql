@@ -0,0 +1,20 @@
+with ca_expanded as (
+select
+			id,
+			num_issued[1] as num_certs_issued,
+			num_issued[2] as num_precerts_issued,
+			num_expired[1] as num_certs_expired,
+			num_expired[2] as num_precerts_expired,
+			-- last_not_after,
+			-- next_not_after,
+			linting_applies,
+			name
+		from ca
+)
+select *
+from ca_expanded
+where id > $1
+order by id
+limit $2
+-- $1 = 42 (int64)
+-- $2 = 10000 (int64)
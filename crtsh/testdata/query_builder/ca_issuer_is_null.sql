@@ -0,0 +1,4 @@
+select ca_id, url, result, to_jsonb(ca_certificate_ids) as ca_certificate_ids, first_certificate_id, is_active, content_type, next_check_due, last_checked
+from ca_issuer
+where next_check_due is null and last_checked > $1 and result is not null
+-- $1 = 2025-01-01T00:00:00Z
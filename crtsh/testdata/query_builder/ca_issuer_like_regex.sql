@@ -0,0 +1,7 @@
+select ca_id, url, result, to_jsonb(ca_certificate_ids) as ca_certificate_ids, first_certificate_id, is_active, content_type, next_check_due, last_checked
+from ca_issuer
+where url ~~* $1 and url !~~ $2 and result ~ $3 and content_type !~* $4
+-- $1 = '%.crt'
+-- $2 = 'http://%'
+-- $3 = '^HTTP [45]'
+-- $4 = 'pem'
@@ -0,0 +1,7 @@
+select ca_id, url, result, to_jsonb(ca_certificate_ids) as ca_certificate_ids, first_certificate_id, is_active, content_type, next_check_due, last_checked
+from ca_issuer
+where ca_id = $1
+order by last_checked desc nulls first, url asc nulls last
+limit $2
+-- $1 = 1 (int64)
+-- $2 = 10 (int64)
@@ -0,0 +1,18 @@
+with ca_expanded as (
+select
+			id,
+			num_issued[1] as num_certs_issued,
+			num_issued[2] as num_precerts_issued,
+			num_expired[1] as num_certs_expired,
+			num_expired[2] as num_precerts_expired,
+			-- last_not_after,
+			-- next_not_after,
+			linting_applies,
+			name
+		from ca
+)
+select *
+from ca_expanded
+where id = any($1) and name <> all($2)
+-- $1 = '{1,2,3}' (*pq.Int64Array)
+-- $2 = '{"a","b"}' (*pq.StringArray)
@@ -0,0 +1,15 @@
+with ca_expanded as (
+select
+			id,
+			num_issued[1] as num_certs_issued,
+			num_issued[2] as num_precerts_issued,
+			num_expired[1] as num_certs_expired,
+			num_expired[2] as num_precerts_expired,
+			-- last_not_after,
+			-- next_not_after,
+			linting_applies,
+			name
+		from ca
+)
+select *
+from ca_expanded
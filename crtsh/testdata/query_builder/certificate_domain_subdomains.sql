@@ -0,0 +1,5 @@
+select distinct on (certificate_id) certificate_id, issuer_ca_id, name_type, name_value, certificate, x509_notAfter(certificate) as not_after
+from certificate_and_identities
+where reverse(lower(name_value)) like $1
+order by certificate_id desc
+-- $1 = 'moc.elpmaxe.etis\_ym.%'
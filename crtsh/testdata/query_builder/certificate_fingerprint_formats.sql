@@ -0,0 +1,6 @@
+select distinct on (certificate_id) certificate_id, issuer_ca_id, name_type, name_value, certificate, x509_notAfter(certificate) as not_after
+from certificate_and_identities
+where digest(certificate, 'sha1') = $1 and digest(x509_publicKey(certificate), 'sha256') = $2
+order by certificate_id desc
+-- $1 = '\x00112233445566778899aabbccddeeff00112233'::bytea
+-- $2 = '\x9b89751c9c9154b70f9fce21f455bdc5ae8297db9b89751c9c9154b70f9fce21'::bytea
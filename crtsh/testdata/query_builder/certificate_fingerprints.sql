@@ -0,0 +1,6 @@
+select distinct on (certificate_id) certificate_id, issuer_ca_id, name_type, name_value, certificate, x509_notAfter(certificate) as not_after
+from certificate_and_identities
+where digest(certificate, 'sha1') = any($1) and digest(certificate, 'sha256') = $2
+order by certificate_id desc
+-- $1 = '{"\\x00112233445566778899aabbccddeeff00112233","\\x"}' (pq.ByteaArray)
+-- $2 = '\x0b4eb1c17d6a7d8b7a3e2e3f0c0e8e4f5f35e7d0c8e2b5d0a8d7c6b5a4f3e2d1'::bytea
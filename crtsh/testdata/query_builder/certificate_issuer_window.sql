@@ -0,0 +1,6 @@
+select distinct on (certificate_id) certificate_id, issuer_ca_id, name_type, name_value, certificate, x509_notAfter(certificate) as not_after
+from certificate_and_identities
+where x509_notBefore(certificate) > $1 and issuer_ca_id = any($2)
+order by certificate_id desc
+-- $1 = 2025-01-01T00:00:00Z
+-- $2 = '{16418,183267}' (*pq.Int64Array)
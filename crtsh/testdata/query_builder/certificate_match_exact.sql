@@ -0,0 +1,8 @@
+select distinct on (certificate_id) certificate_id, issuer_ca_id, name_type, name_value, certificate, x509_notAfter(certificate) as not_after
+from certificate_and_identities
+where name_type = $1 and plainto_tsquery('certwatch', $2) @@ identities(certificate) and lower(name_value) = lower($2)
+order by certificate_id desc
+limit $3
+-- $1 = 'dNSName'
+-- $2 = 'example.com'
+-- $3 = 5 (int64)
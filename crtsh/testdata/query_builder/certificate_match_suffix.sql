@@ -0,0 +1,5 @@
+select distinct on (certificate_id) certificate_id, issuer_ca_id, name_type, name_value, certificate, x509_notAfter(certificate) as not_after
+from certificate_and_identities
+where plainto_tsquery('certwatch', $1) @@ identities(certificate) and (lower(name_value) = lower($1) or right(lower(name_value), length($1) + 1) = '.' || lower($1))
+order by certificate_id desc
+-- $1 = 'example.com'
@@ -0,0 +1,6 @@
+select distinct on (certificate_id) certificate_id, issuer_ca_id, name_type, name_value, certificate, x509_notAfter(certificate) as not_after
+from certificate_and_identities
+where name_type = 'organizationName' and lower(name_value) = lower($1) and name_type in ('emailAddress', 'rfc822Name') and lower(name_value) = lower($2)
+order by certificate_id desc
+-- $1 = 'Example Corp Ltd'
+-- $2 = 'admin@example.com'
@@ -0,0 +1,5 @@
+select distinct on (certificate_id) certificate_id, issuer_ca_id, name_type, name_value, certificate, x509_notAfter(certificate) as not_after
+from certificate_and_identities
+where digest(x509_publicKey(certificate), 'sha256') = $1
+order by certificate_id desc
+-- $1 = '\x9b89751c9c9154b70f9fce21f455bdc5ae8297db9b89751c9c9154b70f9fce21'::bytea
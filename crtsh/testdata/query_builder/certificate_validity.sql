@@ -0,0 +1,8 @@
+select distinct on (certificate_id) certificate_id, issuer_ca_id, name_type, name_value, certificate, x509_notAfter(certificate) as not_after
+from certificate_and_identities
+where x509_notAfter(certificate) > $1 and x509_notBefore(certificate) <= $2 and issuer_ca_id <> $3 and plainto_tsquery('certwatch', $4) @@ identities(certificate) and name_value ilike ('%' || $4 || '%') and x509_notAfter(certificate) > now() at time zone 'UTC'
+order by certificate_id desc
+-- $1 = 2025-01-01T00:00:00Z
+-- $2 = 2025-02-01T00:00:00Z
+-- $3 = 16418 (int64)
+-- $4 = 'example.com'
@@ -0,0 +1,12 @@
+select *
+from (
+select distinct on (a) a, b
+from t
+where b = $1
+) as s
+where a > $2
+order by b desc
+limit $3
+-- $1 = 'x'
+-- $2 = 1 (int64)
+-- $3 = 3 (int64)
@@ -0,0 +1,9 @@
+select certificate_id, entry_id, entry_timestamp, ct_log_id
+from ct_log_entry
+where certificate_id = any($1) and (ct_log_id, entry_id) > ($2, $3)
+order by ct_log_id, entry_id
+limit $4
+-- $1 = '{101,102}' (*pq.Int64Array)
+-- $2 = 2 (int64)
+-- $3 = 500 (int64)
+-- $4 = 100 (int64)
@@ -0,0 +1,8 @@
+select certificate_id, entry_id, entry_timestamp, ct_log_id
+from ct_log_entry
+where entry_timestamp >= $1 and entry_timestamp < $2
+order by ct_log_id, entry_id
+limit $3
+-- $1 = 2025-01-01T00:00:00Z
+-- $2 = 2025-02-01T00:00:00Z
+-- $3 = 10000 (int64)
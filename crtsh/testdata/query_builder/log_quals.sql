@@ -0,0 +1,7 @@
+select id, operator, url, name, public_key, is_active, latest_update, latest_sth_timestamp, mmd_in_seconds, tree_size, batch_size, chunk_size, google_uptime, chrome_version_added, chrome_inclusion_status, chrome_issue_number, chrome_final_tree_size, chrome_disqualified_at, apple_inclusion_status, apple_last_status_change
+from ct_log
+where operator ~~* $1 and is_active = $2 and tree_size > $3 and chrome_inclusion_status = any($4) and chrome_disqualified_at is null
+-- $1 = '%google%'
+-- $2 = true (bool)
+-- $3 = 1000000 (int64)
+-- $4 = '{"Usable","Qualified"}' (*pq.StringArray)
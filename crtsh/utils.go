@@ -1,6 +1,7 @@
 package crtsh
 
 import (
+	"bytes"
 	"context"
 	"crypto/ecdsa"
 	"crypto/rsa"
@@ -13,10 +14,8 @@ import (
 	"math/big"
 	"regexp"
 	"strings"
-	"time"
-
-	"github.com/jmoiron/sqlx"
 
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
 )
@@ -35,6 +34,9 @@ func sha1Fingerprint(_ context.Context, d *transform.TransformData) (interface{}
 	ba := d.Value.([]byte)
 	sum := sha1.Sum(ba)
 	sumSlice := sum[:]
+	if searched, ok := searchedValue(d, "fingerprint_sha1", sumSlice, hexBytes); ok {
+		return searched, nil
+	}
 	hexString := hex.EncodeToString(sumSlice)
 	return hexString, nil
 }
@@ -46,20 +48,93 @@ func sha256Fingerprint(_ context.Context, d *transform.TransformData) (interface
 	ba := d.Value.([]byte)
 	sum := sha256.Sum256(ba)
 	sumSlice := sum[:]
+	if searched, ok := searchedValue(d, "fingerprint_sha256", sumSlice, hexBytes); ok {
+		return searched, nil
+	}
 	hexString := hex.EncodeToString(sumSlice)
 	return hexString, nil
 }
 
+// spkiSha256 hashes the DER encoded Subject Public Key Info, in the same
+// format as the fingerprints. This is the hash used by crt.sh to search by
+// public key.
+func spkiSha256(_ context.Context, d *transform.TransformData) (interface{}, error) {
+	ba, _ := d.Value.([]byte)
+	if len(ba) == 0 {
+		return nil, nil
+	}
+	sum := sha256.Sum256(ba)
+	if searched, ok := searchedValue(d, "spki_sha256", sum[:], hexBytes); ok {
+		return searched, nil
+	}
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// searchedValue returns the value of a qual for the column that parses to
+// b. Hashes and serial numbers can be searched in several formats, e.g.
+// uppercase or colon separated hex, so the column returns the searched value
+// for a matching certificate. Otherwise Postgres would filter out the row as
+// the formats differ.
+func searchedValue(d *transform.TransformData, column string, b []byte, parse func(string) ([]byte, bool)) (string, bool) {
+	for _, q := range d.KeyColumnQuals[column] {
+		values := []*proto.QualValue{q.Value}
+		if list := q.Value.GetListValue(); list != nil {
+			values = list.Values
+		}
+		for _, v := range values {
+			if parsed, ok := parse(v.GetStringValue()); ok && bytes.Equal(parsed, b) {
+				return v.GetStringValue(), true
+			}
+		}
+	}
+	return "", false
+}
+
+// hexBytes parses a hash in plain, colon or space separated hex of either
+// case, e.g. abcd01..., AB:CD:01... or AB CD 01... as shown by browsers.
+func hexBytes(s string) ([]byte, bool) {
+	b, err := hex.DecodeString(strings.NewReplacer(":", "", " ", "").Replace(s))
+	if err != nil {
+		return nil, false
+	}
+	return b, true
+}
+
 func serialNumberToHex(_ context.Context, d *transform.TransformData) (interface{}, error) {
 	i := d.Value.(*big.Int)
 	if i == nil {
 		return nil, nil
 	}
+	// Serial numbers can be searched in plain or colon separated hex
+	if searched, ok := searchedValue(d, "serial_number", serialNumberDER(i), serialNumberBytes); ok {
+		return searched, nil
+	}
 	hexString := fmt.Sprintf("%036x", i)
 	re := regexp.MustCompile("..")
 	return strings.TrimRight(re.ReplaceAllString(hexString, "$0:"), ":"), nil
 }
 
+// serialNumberBytes parses a serial number in plain or colon separated hex,
+// e.g. 8f00112233445566 or 00:8f:00:11:22:33:44:55:66, returning it encoded
+// as in the certificate.
+func serialNumberBytes(s string) ([]byte, bool) {
+	i, ok := new(big.Int).SetString(strings.ReplaceAll(s, ":", ""), 16)
+	if !ok || i.Sign() < 0 {
+		return nil, false
+	}
+	return serialNumberDER(i), true
+}
+
+// serialNumberDER returns the content bytes of the DER INTEGER encoding of a
+// positive serial number, which is what crt.sh indexes.
+func serialNumberDER(i *big.Int) []byte {
+	b := i.Bytes()
+	if len(b) == 0 || b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return b
+}
+
 func publicKeyToPem(ctx context.Context, d *transform.TransformData) (interface{}, error) {
 	var result interface{}
 	switch d.Value.(type) {
@@ -109,68 +184,3 @@ func ecdsaPublicKeyToPem(ctx context.Context, d *transform.TransformData) (inter
 	)
 	return pubkeyPem, nil
 }
-
-func connect(ctx context.Context, d *plugin.QueryData) (*sqlx.DB, error) {
-
-	cacheKey := "crtsh"
-	if cachedData, ok := d.ConnectionManager.Cache.Get(cacheKey); ok {
-		conn := cachedData.(*sqlx.DB)
-		if err := conn.PingContext(ctx); err == nil {
-			// Cached connection is good, return it
-			return conn, nil
-		}
-	}
-
-	connString := "postgres://guest@crt.sh:5432/certwatch?binary_parameters=yes"
-	db, err := sqlx.Connect("postgres", connString)
-	if err != nil {
-		plugin.Logger(ctx).Error("crtsh_ca_issuer.listCaIssuer", "connection_error", err)
-		return nil, err
-	}
-
-	// Save to cache
-	d.ConnectionManager.Cache.Set(cacheKey, db)
-
-	return db, err
-}
-
-func queryWithQuals(ctx context.Context, d *plugin.QueryData, inputQuery string) (query string, args []interface{}) {
-
-	query = inputQuery
-
-	whereClauses := []string{}
-	for _, col := range d.Table.Columns {
-		if d.Quals[col.Name] == nil {
-			continue
-		}
-		for _, q := range d.Quals[col.Name].Quals {
-			switch col.Type.String() {
-			case "STRING":
-				args = append(args, q.Value.GetStringValue())
-			case "TIMESTAMP":
-				args = append(args, q.Value.GetTimestampValue().AsTime().Format(time.RFC3339))
-			case "INT":
-				args = append(args, q.Value.GetInt64Value())
-			case "BOOL":
-				args = append(args, q.Value.GetBoolValue())
-			default:
-				continue
-			}
-			whereClauses = append(whereClauses, fmt.Sprintf("%s %s $%d", col.Name, q.Operator, len(args)))
-		}
-	}
-	if len(whereClauses) > 0 {
-		query = query + "where " + strings.Join(whereClauses, " and ")
-	}
-
-	limit := d.QueryContext.Limit
-	if limit != nil {
-		args = append(args, *limit)
-		query = fmt.Sprintf("%s limit $%d", query, len(args))
-	}
-
-	plugin.Logger(ctx).Debug("crtsh_ca_issuer.listCaIssuer", "query", regexp.MustCompile(`(?m)[\s\n]+`).ReplaceAllString(query, " "))
-	plugin.Logger(ctx).Debug("crtsh_ca_issuer.listCaIssuer", "args", args)
-
-	return
-}
@@ -0,0 +1,78 @@
+package crtsh
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/quals"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
+)
+
+// TestSearchedFormats checks a certificate found by a hash or serial number
+// in another format returns the searched value, so Postgres keeps the row.
+func TestSearchedFormats(t *testing.T) {
+	der := testCertificate(t, 0x8f0011, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprint := sha256.Sum256(der)
+	canonical := hex.EncodeToString(fingerprint[:])
+	upper := strings.ToUpper(canonical)
+	var pairs []string
+	for i := 0; i < len(upper); i += 2 {
+		pairs = append(pairs, upper[i:i+2])
+	}
+
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{"no qual", nil, canonical},
+		{"canonical", canonical, canonical},
+		{"uppercase", upper, upper},
+		{"colons", strings.Join(pairs, ":"), strings.Join(pairs, ":")},
+		{"spaces", strings.Join(pairs, " "), strings.Join(pairs, " ")},
+		{"list", []interface{}{"00", upper}, upper},
+		{"other certificate", strings.Repeat("AB", 32), canonical},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &transform.TransformData{Value: der, KeyColumnQuals: map[string]quals.QualSlice{}}
+			if tt.value != nil {
+				d.KeyColumnQuals["fingerprint_sha256"] = quals.QualSlice{testQual("fingerprint_sha256", "=", tt.value)}
+			}
+			got, err := sha256Fingerprint(testContext(), d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got fingerprint_sha256 %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	d := &transform.TransformData{Value: cert.SerialNumber, KeyColumnQuals: map[string]quals.QualSlice{
+		"serial_number": {testQual("serial_number", "=", "8F0011")},
+	}}
+	if got, _ := serialNumberToHex(testContext(), d); got != "8F0011" {
+		t.Errorf("got serial_number %v, want the searched 8F0011", got)
+	}
+}
+
+func TestDecodeHex(t *testing.T) {
+	want := []byte{0xab, 0xcd, 0x01}
+	for _, s := range []string{"abcd01", "ABCD01", "AB:CD:01", "AB CD 01"} {
+		if got := decodeHex(s); string(got) != string(want) {
+			t.Errorf("decodeHex(%q) = %x, want %x", s, got, want)
+		}
+	}
+	if got := decodeHex("not hex"); got == nil || len(got) != 0 {
+		t.Errorf("decodeHex of invalid hex = %#v, want empty bytes", got)
+	}
+}
@@ -0,0 +1,55 @@
+-- Fixture data for the certwatch stand-in. The certificates were issued by
+-- a throwaway test CA for this harness, they are not real certificates.
+
+insert into ca (id, name, num_issued, num_expired, linting_applies) values
+  (1, 'C=US, O=Steampipe Test, CN=Steampipe Test CA', '{4,0}', '{1,0}', true),
+  (2, 'C=US, O=Retired Test, CN=Retired Test CA', '{0,0}', '{0,0}', false);
+
+insert into ca_issuer (ca_id, url, next_check_due, first_certificate_id, last_checked, result, content_type, ca_certificate_ids, is_active) values
+  (1, 'http://ca.example.test/root.crt', '2025-07-01 00:00:00', 100, '2025-06-01 00:00:00', 'OK', 'application/pkix-cert', '{100}', true),
+  (1, 'http://ca.example.test/root.pem', null, null, null, null, null, null, false),
+  (2, 'http://retired.example.test/ca.crt', '2025-07-01 00:00:00', null, '2025-06-01 00:00:00', 'HTTP 404', 'text/html', null, false);
+
+insert into ct_log (id, operator, url, name, is_active, latest_update, latest_sth_timestamp, mmd_in_seconds, tree_size, batch_size, chunk_size, google_uptime, chrome_version_added, chrome_inclusion_status, chrome_issue_number, chrome_final_tree_size, chrome_disqualified_at, apple_inclusion_status, apple_last_status_change) values
+  (1, 'Example Operator', 'https://ct.example.test/2025/', 'Example 2025 Log', true, '2025-06-01 00:00:00', '2025-06-01 00:00:00', 86400, 1000, 256, 32, '99.9', 100, 'Usable', 1234, null, null, 'Usable', '2024-01-01 00:00:00'),
+  (2, 'Retired Operator', 'https://ct.retired.test/', 'Retired Log', false, '2023-01-01 00:00:00', '2023-01-01 00:00:00', 86400, 500, 256, 32, null, 80, 'Retired', 99, 500, '2023-01-01 00:00:00', 'Expired', '2023-01-01 00:00:00');
+
+insert into certificate (id, issuer_ca_id, certificate) values
+  (100, 1, decode('3082019c30820142a003020102020203e8300a06082a8648ce3d040302303531173015060355040a130e537465616d706970652054657374311a301806035504031311537465616d706970652054657374204341301e170d3230303130313030303030305a170d3430303130313030303030305a303531173015060355040a130e537465616d706970652054657374311a301806035504031311537465616d7069706520546573742043413059301306072a8648ce3d020106082a8648ce3d030107034200041e927254b5a29b90226414ab6898d66fab0559b981e33fc72ba334c28e30c7a88197f96042a8885eac0d2e7747a81bbe0ec9b90e30588dd6223cafc57b7ba587a3423040300e0603551d0f0101ff040403020204300f0603551d130101ff040530030101ff301d0603551d0e041604149b89751c9c9154b70f9fce21f455bdc5ae8297db300a06082a8648ce3d0403020348003045022012eea175a8bc1f1736f5802e38ea477abad2255a9580e793a20c01d81d0a7374022100ad7fa528d849664da4d5e3a93ce56293dbf228576eca407e18ff08db98453164', 'hex')),
+  (101, 1, decode('3082018b30820131a00302010202060a1b2c3d4e5f300a06082a8648ce3d040302303531173015060355040a130e537465616d706970652054657374311a301806035504031311537465616d706970652054657374204341301e170d3234303130313030303030305a170d3234303430313030303030305a3016311430120603550403130b6578616d706c652e636f6d3059301306072a8648ce3d020106082a8648ce3d03010703420004e3dfb1bbe7b3eed0f411ab5b9ea968040909d24fcbc324c71f4dd34e27ecb0460b3b87e8a59914f23e1cd94bf5d20621bb4ad7fa3785cab3e27c3373b7ee5446a34c304a301f0603551d230418301680149b89751c9c9154b70f9fce21f455bdc5ae8297db30270603551d110420301e820b6578616d706c652e636f6d820f7777772e6578616d706c652e636f6d300a06082a8648ce3d0403020348003045022007e10600415cea487de7a112bdade94fc952f5321233286dcebcb82a00acdc16022100ee1daaa5184c5ce88c38cd09b9b99e4d1375c9b12cc85d54d70bd17bb0b0822b', 'hex')),
+  (102, 1, decode('3082018d30820134a0030201020209008f00112233445566300a06082a8648ce3d040302303531173015060355040a130e537465616d706970652054657374311a301806035504031311537465616d706970652054657374204341301e170d3235303130313030303030305a170d3335303130313030303030305a3016311430120603550403130b6578616d706c652e636f6d3059301306072a8648ce3d020106082a8648ce3d03010703420004e3dfb1bbe7b3eed0f411ab5b9ea968040909d24fcbc324c71f4dd34e27ecb0460b3b87e8a59914f23e1cd94bf5d20621bb4ad7fa3785cab3e27c3373b7ee5446a34c304a301f0603551d230418301680149b89751c9c9154b70f9fce21f455bdc5ae8297db30270603551d110420301e820b6578616d706c652e636f6d820f6170692e6578616d706c652e636f6d300a06082a8648ce3d040302034700304402200bd4feae80726bae1b56be24f0b15e74c79b841c68e8eeb66b828a2fa73a1f2602200c7793cea9760d24686c4f5a0f085de2fa57d0e9f538b255001ca1b55dd87122', 'hex')),
+  (103, 1, decode('3082018e30820134a00302010202020102300a06082a8648ce3d040302303531173015060355040a130e537465616d706970652054657374311a301806035504031311537465616d706970652054657374204341301e170d3235303130313030303030305a170d3335303130313030303030305a30223120301e060355040313176e6f746578616d706c652e636f6d2e6576696c2e6e65743059301306072a8648ce3d020106082a8648ce3d03010703420004c3fa93a01e22eba390ba94dd5fb5cf50d7b5234aab4012fff42ed5ee0990b6b78ee97e8705de006c28389d44e093b8d6874bb5c6a07e1ea55cc48a5ae8504bcaa3473045301f0603551d230418301680149b89751c9c9154b70f9fce21f455bdc5ae8297db30220603551d11041b301982176e6f746578616d706c652e636f6d2e6576696c2e6e6574300a06082a8648ce3d0403020348003045022100d149332e9182212ff7667a6bf9ffddc9b16e2f4880eaf30c7a3b89f26576c2b802204168978cfac6ebc0a64b316304f01fe5012ae109d51e15b3fbb58c79a6815e26', 'hex')),
+  (104, 1, decode('308201b230820158a00302010202027e57300a06082a8648ce3d040302303531173015060355040a130e537465616d706970652054657374311a301806035504031311537465616d706970652054657374204341301e170d3235303630313030303030305a170d3335303630313030303030305a303831193017060355040a13104578616d706c6520436f7270204c7464311b3019060355040313127365637572652e6578616d706c652e636f6d3059301306072a8648ce3d020106082a8648ce3d03010703420004c3fa93a01e22eba390ba94dd5fb5cf50d7b5234aab4012fff42ed5ee0990b6b78ee97e8705de006c28389d44e093b8d6874bb5c6a07e1ea55cc48a5ae8504bcaa3553053301f0603551d230418301680149b89751c9c9154b70f9fce21f455bdc5ae8297db30300603551d110429302782127365637572652e6578616d706c652e636f6d811161646d696e406578616d706c652e636f6d300a06082a8648ce3d04030203480030450220133720d5ce7ac0489b1b1c011a30ec24602abc8c12aecc2c0bd71ea630ac42fe022100b5cc72415fbd24f0efd939e19e59c16934e34be2a8bff8c00852217c0d17d8d9', 'hex'));
+
+insert into certificate_identity (certificate_id, name_type, name_value, issuer_ca_id) values
+  (100, 'commonName', 'Steampipe Test CA', 1),
+  (100, 'organizationName', 'Steampipe Test', 1),
+  (101, 'commonName', 'example.com', 1),
+  (101, 'dNSName', 'example.com', 1),
+  (101, 'dNSName', 'www.example.com', 1),
+  (102, 'commonName', 'example.com', 1),
+  (102, 'dNSName', 'example.com', 1),
+  (102, 'dNSName', 'api.example.com', 1),
+  (103, 'commonName', 'notexample.com.evil.net', 1),
+  (103, 'dNSName', 'notexample.com.evil.net', 1),
+  (104, 'commonName', 'secure.example.com', 1),
+  (104, 'organizationName', 'Example Corp Ltd', 1),
+  (104, 'dNSName', 'secure.example.com', 1),
+  (104, 'rfc822Name', 'admin@example.com', 1);
+
+insert into ct_log_entry (certificate_id, entry_id, entry_timestamp, ct_log_id) values
+  (101, 1, '2024-01-01 00:05:00', 1),
+  (101, 1, '2024-01-01 00:06:00', 2),
+  (102, 2, '2025-01-01 00:05:00', 1),
+  (103, 3, '2025-01-01 00:07:00', 1),
+  (104, 4, '2025-06-01 00:05:00', 1);
+
+insert into x509_fixture (certificate, not_before, not_after, serial_number, public_key)
+  select certificate, v.not_before::timestamp, v.not_after::timestamp, decode(v.serial_number, 'hex'), decode(v.public_key, 'hex')
+  from certificate c join (values
+    (100, '2020-01-01 00:00:00', '2040-01-01 00:00:00', '03e8', '3059301306072a8648ce3d020106082a8648ce3d030107034200041e927254b5a29b90226414ab6898d66fab0559b981e33fc72ba334c28e30c7a88197f96042a8885eac0d2e7747a81bbe0ec9b90e30588dd6223cafc57b7ba587'),
+    (101, '2024-01-01 00:00:00', '2024-04-01 00:00:00', '0a1b2c3d4e5f', '3059301306072a8648ce3d020106082a8648ce3d03010703420004e3dfb1bbe7b3eed0f411ab5b9ea968040909d24fcbc324c71f4dd34e27ecb0460b3b87e8a59914f23e1cd94bf5d20621bb4ad7fa3785cab3e27c3373b7ee5446'),
+    (102, '2025-01-01 00:00:00', '2035-01-01 00:00:00', '008f00112233445566', '3059301306072a8648ce3d020106082a8648ce3d03010703420004e3dfb1bbe7b3eed0f411ab5b9ea968040909d24fcbc324c71f4dd34e27ecb0460b3b87e8a59914f23e1cd94bf5d20621bb4ad7fa3785cab3e27c3373b7ee5446'),
+    (103, '2025-01-01 00:00:00', '2035-01-01 00:00:00', '0102', '3059301306072a8648ce3d020106082a8648ce3d03010703420004c3fa93a01e22eba390ba94dd5fb5cf50d7b5234aab4012fff42ed5ee0990b6b78ee97e8705de006c28389d44e093b8d6874bb5c6a07e1ea55cc48a5ae8504bca'),
+    (104, '2025-06-01 00:00:00', '2035-06-01 00:00:00', '7e57', '3059301306072a8648ce3d020106082a8648ce3d03010703420004c3fa93a01e22eba390ba94dd5fb5cf50d7b5234aab4012fff42ed5ee0990b6b78ee97e8705de006c28389d44e093b8d6874bb5c6a07e1ea55cc48a5ae8504bca')
+  ) v (id, not_before, not_after, serial_number, public_key) on v.id = c.id;
@@ -0,0 +1,21 @@
+#!/usr/bin/env bash
+#
+# Create the certwatch stand-in schema and load the fixtures into a local
+# Postgres database. Connection settings are read from the standard libpq
+# environment variables (PGHOST, PGPORT, PGUSER, PGPASSWORD), e.g.
+#
+#   createdb certwatch
+#   PGHOST=localhost PGUSER=postgres ./load.sh certwatch
+#
+# WARNING: this drops and recreates the public schema of the database.
+
+set -euo pipefail
+
+cd "$(dirname "$0")"
+
+database="${1:-certwatch}"
+
+psql --quiet --set ON_ERROR_STOP=1 --dbname "$database" --file schema.sql
+psql --quiet --set ON_ERROR_STOP=1 --dbname "$database" --file fixtures.sql
+
+echo "Loaded certwatch fixtures into ${database}"
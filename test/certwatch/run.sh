@@ -0,0 +1,34 @@
+#!/usr/bin/env bash
+#
+# Run each test query against the certwatch stand-in and compare the results
+# with the expected output. Each test is a directory under tests/ holding a
+# query.sql and an expected.json of the rows it returns.
+#
+# The plugin must be installed (make install) and the crtsh_test connection
+# from crtsh.spc configured, pointing at a database loaded with load.sh.
+#
+#   ./run.sh            run every test
+#   ./run.sh crtsh_log  run the tests for tables starting with crtsh_log
+#   UPDATE=1 ./run.sh   rewrite expected.json from the current results
+
+set -euo pipefail
+
+cd "$(dirname "$0")"
+
+failed=0
+for dir in tests/${1:-}*/*/; do
+  name="${dir#tests/}"
+  name="${name%/}"
+  actual="$(steampipe query --output json --search-path crtsh_test < "${dir}query.sql" | jq -S '.rows')"
+  if [[ -n "${UPDATE:-}" ]]; then
+    echo "$actual" > "${dir}expected.json"
+    echo "UPDATED ${name}"
+  elif diff -u <(jq -S . "${dir}expected.json") <(echo "$actual"); then
+    echo "PASS ${name}"
+  else
+    echo "FAIL ${name}"
+    failed=1
+  fi
+done
+
+exit $failed
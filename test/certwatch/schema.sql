@@ -0,0 +1,136 @@
+-- Minimal stand-in for the crt.sh certwatch schema, with just the tables,
+-- views and functions queried by the plugin. Column names and types follow
+-- https://github.com/crtsh/certwatch_db.
+--
+-- The x509_* and identities functions are implemented in C on crt.sh. Here
+-- they are stubs which look up values precomputed for each fixture
+-- certificate in x509_fixture.
+
+drop schema if exists public cascade;
+create schema public;
+
+create extension pgcrypto;
+
+create text search configuration certwatch (copy = simple);
+
+create table ca (
+  id integer primary key,
+  name text not null,
+  public_key bytea,
+  num_issued bigint[],
+  num_expired bigint[],
+  last_not_after timestamp,
+  next_not_after timestamp,
+  linting_applies boolean not null default true
+);
+
+create table ca_issuer (
+  ca_id integer not null references ca (id),
+  url text not null,
+  next_check_due timestamp,
+  first_certificate_id bigint,
+  last_checked timestamp,
+  result text,
+  content_type text,
+  ca_certificate_ids bigint[],
+  is_active boolean,
+  primary key (ca_id, url)
+);
+
+create table ct_log (
+  id smallint primary key,
+  operator text,
+  url text,
+  name text,
+  public_key bytea,
+  is_active boolean,
+  latest_update timestamp,
+  latest_sth_timestamp timestamp,
+  mmd_in_seconds integer,
+  tree_size bigint,
+  batch_size integer,
+  chunk_size integer,
+  google_uptime text,
+  chrome_version_added integer,
+  chrome_inclusion_status text,
+  chrome_issue_number integer,
+  chrome_final_tree_size bigint,
+  chrome_disqualified_at timestamp,
+  apple_inclusion_status text,
+  apple_last_status_change timestamp
+);
+
+create table certificate (
+  id bigint primary key,
+  issuer_ca_id integer not null references ca (id),
+  certificate bytea not null
+);
+
+create table certificate_identity (
+  certificate_id bigint not null references certificate (id),
+  name_type text not null,
+  name_value text not null,
+  issuer_ca_id integer not null
+);
+
+create table ct_log_entry (
+  certificate_id bigint not null references certificate (id),
+  entry_id bigint not null,
+  entry_timestamp timestamp not null,
+  ct_log_id smallint not null references ct_log (id),
+  primary key (ct_log_id, entry_id)
+);
+
+create view certificate_and_identities as
+  select
+    c.id as certificate_id,
+    c.issuer_ca_id,
+    ci.name_type,
+    ci.name_value,
+    c.certificate
+  from
+    certificate c
+    join certificate_identity ci on ci.certificate_id = c.id;
+
+-- Values parsed from each fixture certificate, returned by the x509_* stubs.
+create table x509_fixture (
+  certificate bytea primary key,
+  not_before timestamp not null,
+  not_after timestamp not null,
+  serial_number bytea not null,
+  public_key bytea not null
+);
+
+create function x509_notAfter(bytea) returns timestamp
+  language sql stable
+  as $$ select not_after from x509_fixture where certificate = $1 $$;
+
+create function x509_notBefore(bytea) returns timestamp
+  language sql stable
+  as $$ select not_before from x509_fixture where certificate = $1 $$;
+
+create function x509_serialNumber(bytea) returns bytea
+  language sql stable
+  as $$ select serial_number from x509_fixture where certificate = $1 $$;
+
+-- Returns the DER encoded SubjectPublicKeyInfo, as on crt.sh
+create function x509_publicKey(bytea) returns bytea
+  language sql stable
+  as $$ select public_key from x509_fixture where certificate = $1 $$;
+
+-- crt.sh indexes each identity and every parent domain of DNS names, so that
+-- a search for example.com also finds www.example.com.
+create function identities(bytea) returns tsvector
+  language sql stable
+  as $$
+    select to_tsvector('certwatch', coalesce(string_agg(name, ' '), ''))
+    from (
+      select lower(array_to_string(parts[i:], '.')) as name
+      from (
+        select string_to_array(ci.name_value, '.') as parts
+        from certificate c join certificate_identity ci on ci.certificate_id = c.id
+        where c.certificate = $1
+      ) p,
+      generate_subscripts(parts, 1) as i
+    ) n
+  $$;
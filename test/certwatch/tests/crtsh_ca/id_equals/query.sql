@@ -0,0 +1,10 @@
+select
+  id,
+  name,
+  num_certs_issued,
+  num_certs_expired,
+  linting_applies
+from
+  crtsh_ca
+where
+  id = 1;
@@ -0,0 +1,6 @@
+select
+  id
+from
+  crtsh_ca
+where
+  linting_applies = false;
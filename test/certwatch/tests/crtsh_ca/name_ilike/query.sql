@@ -0,0 +1,7 @@
+select
+  id,
+  name
+from
+  crtsh_ca
+where
+  name ilike '%steampipe test%';
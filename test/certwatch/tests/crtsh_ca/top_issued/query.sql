@@ -0,0 +1,8 @@
+select
+  id,
+  num_certs_issued
+from
+  crtsh_ca
+order by
+  num_certs_issued desc
+limit 1;
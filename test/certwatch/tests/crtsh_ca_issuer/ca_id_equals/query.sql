@@ -0,0 +1,11 @@
+select
+  ca_id,
+  url,
+  result,
+  is_active
+from
+  crtsh_ca_issuer
+where
+  ca_id = 1
+order by
+  url;
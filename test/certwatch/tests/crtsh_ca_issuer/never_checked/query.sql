@@ -0,0 +1,7 @@
+select
+  ca_id,
+  url
+from
+  crtsh_ca_issuer
+where
+  last_checked is null;
@@ -0,0 +1,9 @@
+select
+  ca_id,
+  url
+from
+  crtsh_ca_issuer
+where
+  url ~ '\.crt$'
+order by
+  url;
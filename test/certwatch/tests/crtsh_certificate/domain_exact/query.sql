@@ -0,0 +1,8 @@
+select
+  id
+from
+  crtsh_certificate
+where
+  domain = 'example.com'
+order by
+  id;
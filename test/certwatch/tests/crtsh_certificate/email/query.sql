@@ -0,0 +1,7 @@
+select
+  id,
+  name_type
+from
+  crtsh_certificate
+where
+  email = 'admin@example.com';
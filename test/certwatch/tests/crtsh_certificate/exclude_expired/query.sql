@@ -0,0 +1,9 @@
+select
+  id
+from
+  crtsh_certificate
+where
+  query = 'example.com'
+  and exclude_expired
+order by
+  id;
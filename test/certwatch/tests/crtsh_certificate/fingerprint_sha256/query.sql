@@ -0,0 +1,12 @@
+select
+  id,
+  issuer_ca_id
+from
+  crtsh_certificate
+where
+  fingerprint_sha256 in (
+    '998f3ecec46580e51c2a6953f8fa200b41df9ccec825d44f621e7b71b85084d7',
+    '3a36ac00f8c1d96c786ef6c5bc13d6473923ec31f4d1e8384e5f072ff47ea29b'
+  )
+order by
+  id;
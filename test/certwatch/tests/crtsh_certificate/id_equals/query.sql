@@ -0,0 +1,13 @@
+select
+  id,
+  issuer_ca_id,
+  dns_names,
+  not_before,
+  not_after,
+  serial_number,
+  fingerprint_sha256,
+  is_ca
+from
+  crtsh_certificate
+where
+  id = 102;
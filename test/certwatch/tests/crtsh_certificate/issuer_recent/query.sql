@@ -0,0 +1,9 @@
+select
+  id
+from
+  crtsh_certificate
+where
+  issuer_ca_id = 1
+  and not_before >= '2025-01-01'
+order by
+  id;
@@ -0,0 +1,7 @@
+select
+  id
+from
+  crtsh_certificate
+where
+  query = 'example.com'
+limit 2;
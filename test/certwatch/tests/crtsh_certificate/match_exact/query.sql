@@ -0,0 +1,11 @@
+select
+  id,
+  name_type
+from
+  crtsh_certificate
+where
+  query = 'example.com'
+  and match = 'exact'
+  and name_type = 'dNSName'
+order by
+  id;
@@ -0,0 +1,9 @@
+select
+  id
+from
+  crtsh_certificate
+where
+  query = 'example.com'
+  and match = 'suffix'
+order by
+  id;
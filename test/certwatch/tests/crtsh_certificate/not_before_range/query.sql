@@ -0,0 +1,9 @@
+select
+  id
+from
+  crtsh_certificate
+where
+  query = 'example.com'
+  and not_before >= '2025-01-01'
+  and not_before < '2025-06-01'
+  and issuer_ca_id = 1;
@@ -0,0 +1,8 @@
+select
+  id
+from
+  crtsh_certificate
+where
+  query = 'example.com'
+order by
+  id;
@@ -0,0 +1,8 @@
+select
+  id,
+  serial_number
+from
+  crtsh_certificate
+where
+  serial_number = '8f00112233445566'
+  and issuer_ca_id = 1;
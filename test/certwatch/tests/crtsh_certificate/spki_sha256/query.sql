@@ -0,0 +1,9 @@
+select
+  id,
+  spki_sha256
+from
+  crtsh_certificate
+where
+  spki_sha256 = 'a19e3827fe702027747e2a6d85d6ce560aa17805a3743e406bbfce3406e422c6'
+order by
+  id;
@@ -0,0 +1,10 @@
+select
+  id,
+  name,
+  operator,
+  is_active,
+  tree_size
+from
+  crtsh_log
+order by
+  id;
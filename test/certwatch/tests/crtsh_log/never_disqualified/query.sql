@@ -0,0 +1,7 @@
+select
+  id,
+  name
+from
+  crtsh_log
+where
+  chrome_disqualified_at is null;
@@ -0,0 +1,10 @@
+select
+  id,
+  operator,
+  chrome_inclusion_status
+from
+  crtsh_log
+where
+  operator ilike 'example%'
+  and chrome_inclusion_status = 'Usable'
+  and tree_size >= 1000;
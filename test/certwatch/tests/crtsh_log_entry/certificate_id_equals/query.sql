@@ -0,0 +1,10 @@
+select
+  ct_log_id,
+  entry_id,
+  certificate_id
+from
+  crtsh_log_entry
+where
+  certificate_id = 101
+order by
+  ct_log_id;
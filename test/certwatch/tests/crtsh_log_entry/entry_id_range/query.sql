@@ -0,0 +1,11 @@
+select
+  ct_log_id,
+  entry_id,
+  certificate_id
+from
+  crtsh_log_entry
+where
+  entry_id >= 3
+order by
+  ct_log_id,
+  entry_id;
@@ -0,0 +1,12 @@
+select
+  ct_log_id,
+  entry_id,
+  certificate_id
+from
+  crtsh_log_entry
+where
+  certificate_id in (101, 103)
+  and ct_log_id in (1, 2)
+order by
+  certificate_id,
+  ct_log_id;
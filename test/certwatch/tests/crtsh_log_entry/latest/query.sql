@@ -0,0 +1,10 @@
+select
+  certificate_id,
+  entry_id
+from
+  crtsh_log_entry
+where
+  entry_id >= 1
+order by
+  entry_timestamp desc
+limit 2;